@@ -0,0 +1,126 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/go-nats"
+	"github.com/zwopir/eventhandler/model"
+)
+
+// Action represents the handling of a dispatched message
+type Action interface {
+	// Run handles the message. The returned result is set even if the action fails
+	Run(ctx context.Context, msg *model.Message) (*Result, error)
+}
+
+// Func is an adapter to use an ordinary function as Action
+type Func func(ctx context.Context, msg *model.Message) (*Result, error)
+
+// Run implements the Action interface
+func (f Func) Run(ctx context.Context, msg *model.Message) (*Result, error) {
+	return f(ctx, msg)
+}
+
+// Result represents the outcome of an action run
+type Result struct {
+	// Type is the action type, i.e. "exec"
+	Type string `json:"type"`
+	// Name is the name of a chain step
+	Name string `json:"name,omitempty"`
+	// ExitCode is the exit code of a command. Other actions return 0 on success and 1 on failure.
+	// A command that didn't exit normally returns -1
+	ExitCode int `json:"exit_code"`
+	// StatusCode is the response status code of a http action
+	StatusCode int           `json:"status_code,omitempty"`
+	Stdout     string        `json:"stdout,omitempty"`
+	Stderr     string        `json:"stderr,omitempty"`
+	Started    time.Time     `json:"started"`
+	Duration   time.Duration `json:"duration"`
+	// Steps are the results of the executed and skipped steps of a chain
+	Steps []*Result `json:"steps,omitempty"`
+	// Skipped indicates a chain step whose condition wasn't met
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Vars returns the result as template values, keyed like the json encoding of Result
+func (r *Result) Vars() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        r.Type,
+		"name":        r.Name,
+		"exit_code":   r.ExitCode,
+		"status_code": r.StatusCode,
+		"stdout":      r.Stdout,
+		"stderr":      r.Stderr,
+		"duration":    r.Duration.String(),
+		"skipped":     r.Skipped,
+	}
+}
+
+// Runtime represents the resources of the subscriber that actions may use
+type Runtime struct {
+	// Conn is the nats connection of the subscriber
+	Conn *nats.Conn
+	// Hostname identifies the subscriber
+	Hostname string
+	// DryRun is set by Validate. Factories parse the config as usual but must not
+	// connect, spawn or otherwise acquire resources
+	DryRun bool
+}
+
+// Factory creates an action from its config
+type Factory func(cfg Config, rt Runtime) (Action, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes an action factory available under the action type name. It panics
+// if the name is registered twice
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("action type %q is already registered", name))
+	}
+	registry[name] = f
+}
+
+// Types returns the sorted names of the registered action types
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ret := []string{}
+	for name := range registry {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// New creates the action of the type cfg.Type. An empty type defaults to TypeExec.
+// The built-in factories return ConfigErrors listing all invalid settings
+func New(cfg Config, rt Runtime) (Action, error) {
+	if cfg.Type == "" {
+		cfg.Type = TypeExec
+	}
+	registryMu.RLock()
+	f, ok := registry[cfg.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, ConfigErrors{{Path: "type", Err: fmt.Errorf("unknown action type %q", cfg.Type)}}
+	}
+	return f(cfg, rt)
+}
+
+func init() {
+	Register(TypeExec, newExecAction)
+	Register(TypeHTTP, newHTTPAction)
+	Register(TypeLog, newLogAction)
+	Register(TypeChain, newChainAction)
+	Register(TypePublish, newPublishAction)
+}
@@ -0,0 +1,261 @@
+package action
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+func createTestMessage(payload string) *model.Message {
+	msg, _ := model.NewMessage(model.Envelope{
+		Sender:        []byte("testSender"),
+		Recipient:     []byte("testRecipient"),
+		Payload:       []byte(payload),
+		CorrelationId: []byte("testUUID"),
+	})
+	return msg
+}
+
+func TestRegister(t *testing.T) {
+	Register("test", func(cfg Config, rt Runtime) (Action, error) {
+		return Func(func(ctx context.Context, msg *model.Message) (*Result, error) {
+			return &Result{Type: "test", Stdout: cfg.Args["greeting"]}, nil
+		}), nil
+	})
+	if !reflect.DeepEqual(Types(), []string{TypeChain, TypeExec, TypeHTTP, TypeLog, TypePublish, "test"}) {
+		t.Errorf("unexpected action types %v", Types())
+	}
+	a, err := New(Config{Type: "test", Args: map[string]string{"greeting": "hello"}}, Runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := a.Run(context.Background(), createTestMessage(`{}`))
+	if err != nil || result.Stdout != "hello" {
+		t.Errorf("expected registered action to return hello, got %v (%v)", result, err)
+	}
+	_, err = New(Config{Type: "unknown"}, Runtime{})
+	if err == nil {
+		t.Error("expected unknown action type to fail")
+	}
+}
+
+var execActionTestTable = []struct {
+	args     []string
+	exitCode int
+	stdout   string
+	fail     bool
+}{
+	{[]string{"-c", `cat; echo " {{ .envelope.sender }}"`}, 0, "value testSender\n", false},
+	{[]string{"-c", "exit 3"}, 3, "", true},
+}
+
+func TestExecAction_Run(t *testing.T) {
+	for _, tt := range execActionTestTable {
+		a, err := New(Config{
+			Cmd:           "/bin/sh",
+			CmdArgs:       tt.args,
+			Timeout:       "5s",
+			StdinTemplate: `{{ .key }}`,
+		}, Runtime{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := a.Run(context.Background(), createTestMessage(`{"key":"value"}`))
+		if (err != nil) != tt.fail {
+			t.Errorf("%v: expected failure to be %t, got %v", tt.args, tt.fail, err)
+		}
+		if result.Type != TypeExec || result.ExitCode != tt.exitCode || result.Stdout != tt.stdout {
+			t.Errorf("%v: unexpected result %+v", tt.args, result)
+		}
+	}
+}
+
+func TestLogAction_Run(t *testing.T) {
+	a, err := New(Config{Type: TypeLog, Log: LogConfig{Message: `{{ .key }} from {{ .envelope.sender }}`}}, Runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := a.Run(context.Background(), createTestMessage(`{"key":"value"}`))
+	if err != nil || result.Stdout != "value from testSender" {
+		t.Errorf("unexpected log action result %+v (%v)", result, err)
+	}
+	_, err = New(Config{Type: TypeLog, Log: LogConfig{Level: "loud"}}, Runtime{})
+	if err == nil || !strings.Contains(err.Error(), "loud") {
+		t.Errorf("expected unknown log level to fail, got %v", err)
+	}
+}
+
+func TestLogAction_Run2(t *testing.T) {
+	// templates get payload numbers as float64
+	a, err := New(Config{Type: TypeLog, Log: LogConfig{Message: `{{ printf "%.2f" .load }} {{ if ge .attempt 3.0 }}escalate{{ end }}`}}, Runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := a.Run(context.Background(), createTestMessage(`{"load":1.5,"attempt":3}`))
+	if err != nil || result.Stdout != "1.50 escalate" {
+		t.Errorf("unexpected log action result %+v (%v)", result, err)
+	}
+}
+
+var chainActionTestTable = []struct {
+	diagnose string
+	steps    []string
+	stdout   string
+	fail     bool
+}{
+	// the service is healthy, nothing to remediate
+	{"echo healthy", []string{"diagnose", "notify"}, "notify diagnose=0\n", false},
+	// the diagnosis fails, the service is restarted
+	{"echo down; exit 2", []string{"diagnose", "restart", "notify"}, "notify restart=0\n", false},
+	// the diagnosis fails with an unknown exit code, nothing matches
+	{"exit 1", []string{"diagnose"}, "", true},
+}
+
+func TestChainAction_Run(t *testing.T) {
+	for _, tt := range chainActionTestTable {
+		a, err := New(Config{
+			Type: TypeChain,
+			Steps: []StepConfig{
+				{
+					Name:   "diagnose",
+					Config: Config{Cmd: "/bin/sh", CmdArgs: []string{"-c", tt.diagnose}, Timeout: "5s"},
+				},
+				{
+					Name: "restart",
+					When: WhenConfig{Status: StepOnFailure, ExitCodes: []int{2}, Output: "^down"},
+					Config: Config{
+						Cmd:     "/bin/sh",
+						CmdArgs: []string{"-c", `test "{{ trim .previous.stdout }}" = "down"`},
+						Timeout: "5s",
+					},
+				},
+				{
+					Name: "notify",
+					Config: Config{
+						Cmd:           "/bin/cat",
+						Timeout:       "5s",
+						StdinTemplate: "{{ .key }} {{ .previous.name }}={{ .previous.exit_code }}\n",
+					},
+				},
+			},
+		}, Runtime{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := a.Run(context.Background(), createTestMessage(`{"key":"notify"}`))
+		if (err != nil) != tt.fail {
+			t.Errorf("%q: expected failure to be %t, got %v", tt.diagnose, tt.fail, err)
+		}
+		executed := []string{}
+		for _, step := range result.Steps {
+			if !step.Skipped {
+				executed = append(executed, step.Name)
+			}
+		}
+		if !reflect.DeepEqual(executed, tt.steps) {
+			t.Errorf("%q: expected steps %v to run, got %v", tt.diagnose, tt.steps, executed)
+		}
+		if !tt.fail && result.Stdout != tt.stdout {
+			t.Errorf("%q: expected stdout %q, got %q", tt.diagnose, tt.stdout, result.Stdout)
+		}
+	}
+}
+
+func TestChainAction_Run2(t *testing.T) {
+	// the step variables are available with payloads that aren't json objects
+	a, err := New(Config{
+		Type: TypeChain,
+		Steps: []StepConfig{
+			{Name: "diagnose", Config: Config{Cmd: "/bin/echo", CmdArgs: []string{"{{ index .payload 0 }}"}, Timeout: "5s"}},
+			{Name: "notify", Config: Config{Cmd: "/bin/cat", Timeout: "5s", StdinTemplate: "{{ .previous.name }} {{ .steps.diagnose.stdout }}"}},
+		},
+	}, Runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := a.Run(context.Background(), createTestMessage(`["web1"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stdout != "diagnose web1\n" {
+		t.Errorf("unexpected output of step notify %q", result.Stdout)
+	}
+}
+
+func TestChainAction_Run3(t *testing.T) {
+	// exit code conditions without status select failed steps as well
+	a, err := New(Config{
+		Type: TypeChain,
+		Steps: []StepConfig{
+			{Name: "diagnose", Config: Config{Cmd: "/bin/sh", CmdArgs: []string{"-c", "exit 2"}, Timeout: "5s"}},
+			{Name: "restart", When: WhenConfig{ExitCodes: []int{2}}, Config: Config{Cmd: "/bin/true", Timeout: "5s"}},
+		},
+	}, Runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := a.Run(context.Background(), createTestMessage(`{}`))
+	if err != nil || len(result.Steps) != 2 || result.Steps[1].Skipped {
+		t.Errorf("expected step restart to run, got %+v (%v)", result.Steps, err)
+	}
+}
+
+func TestChainAction_Preview(t *testing.T) {
+	a, err := New(Config{
+		Type: TypeChain,
+		Steps: []StepConfig{
+			{Name: "diagnose", Config: Config{Cmd: "/bin/sh", CmdArgs: []string{"-c", "check {{ .key }}"}, Timeout: "5s"}},
+			{Name: "notify", Config: Config{Type: TypeLog, Log: LogConfig{Message: "{{ .key }} {{ .previous.name }}"}}},
+		},
+	}, Runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview, err := a.(Previewer).Preview(createTestMessage(`{"key":"value"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Steps) != 2 {
+		t.Fatalf("expected 2 step previews, got %+v", preview.Steps)
+	}
+	if args := preview.Steps[0].Rendering.Args; !reflect.DeepEqual(args, []string{"-c", "check value"}) {
+		t.Errorf("unexpected args of step diagnose %q", args)
+	}
+	if preview.Steps[1].Message != "value diagnose" {
+		t.Errorf("unexpected message of step notify %q", preview.Steps[1].Message)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	errs := Validate(Config{
+		Type: TypeChain,
+		Steps: []StepConfig{
+			{Name: "diagnose", Config: Config{Cmd: "/bin/true", Timeout: "5s", User: "no-such-user-eventhandler"}},
+			{Name: "diagnose", Config: Config{Type: TypeHTTP, HTTP: HTTPConfig{Method: "{{ .method"}}},
+			{Config: Config{Type: TypePublish, Publish: PublishConfig{Subject: "alerts"}}},
+		},
+	})
+	paths := []string{}
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	expected := []string{
+		"steps[0].user",
+		"steps[1].name",
+		"steps[1].timeout",
+		"steps[1].http.url",
+		"steps[1].http.method",
+		"steps[2].publish.recipient",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected errors at %q, got %v", expected, errs)
+	}
+	// the factories report the same errors when the action is created
+	_, err := New(Config{Cmd: "/bin/true", Timeout: "5s", User: "no-such-user-eventhandler"}, Runtime{})
+	if !reflect.DeepEqual(configErrors(err), Validate(Config{Cmd: "/bin/true", Timeout: "5s", User: "no-such-user-eventhandler"})) {
+		t.Errorf("expected New and Validate to agree, got %v", err)
+	}
+}
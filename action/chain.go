@@ -0,0 +1,173 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/zwopir/eventhandler/model"
+)
+
+// step conditions on the status of the previous step
+const (
+	StepOnSuccess = "success"
+	StepOnFailure = "failure"
+	StepAlways    = "always"
+)
+
+// chainStep is a parsed chain step
+type chainStep struct {
+	name      string
+	action    Action
+	status    string
+	exitCodes []int
+	output    *regexp.Regexp
+}
+
+// runs indicates if the step runs after the previous result
+func (s chainStep) runs(previous *Result, previousErr error) bool {
+	if previous == nil {
+		return true
+	}
+	switch s.status {
+	case StepOnSuccess:
+		if previousErr != nil {
+			return false
+		}
+	case StepOnFailure:
+		if previousErr == nil {
+			return false
+		}
+	}
+	if len(s.exitCodes) > 0 {
+		found := false
+		for _, code := range s.exitCodes {
+			if code == previous.ExitCode {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if s.output != nil && !s.output.MatchString(previous.Stdout) {
+		return false
+	}
+	return true
+}
+
+// chainAction runs its steps in order. Every step is run with the results of the
+// previous steps as .steps.<name> and the result of the previous executed step as .previous
+type chainAction struct {
+	steps []chainStep
+}
+
+// newChainAction is the Factory of TypeChain actions
+func newChainAction(cfg Config, rt Runtime) (Action, error) {
+	if len(cfg.Steps) == 0 {
+		return nil, ConfigErrors{{Path: "steps", Err: errors.New("chain has no steps")}}
+	}
+	p := &configParser{}
+	a := &chainAction{}
+	names := map[string]bool{}
+	for i, stepCfg := range cfg.Steps {
+		path := fmt.Sprintf("steps[%d]", i)
+		step := chainStep{
+			name:      stepCfg.Name,
+			status:    stepCfg.When.Status,
+			exitCodes: stepCfg.When.ExitCodes,
+		}
+		if step.name == "" {
+			step.name = fmt.Sprintf("step%d", i)
+		}
+		if names[step.name] {
+			p.errorf(JoinPath(path, "name"), "duplicate chain step name %q", step.name)
+		}
+		names[step.name] = true
+		switch step.status {
+		case "":
+			// exit code and output conditions select the previous result themselves
+			step.status = StepOnSuccess
+			if len(step.exitCodes) > 0 || stepCfg.When.Output != "" {
+				step.status = StepAlways
+			}
+		case StepOnSuccess, StepOnFailure, StepAlways:
+		default:
+			p.errorf(JoinPath(path, "when.status"), "invalid status condition %q", step.status)
+		}
+		if stepCfg.When.Output != "" {
+			var err error
+			step.output, err = regexp.Compile(stepCfg.When.Output)
+			if err != nil {
+				p.add(JoinPath(path, "when.output"), err)
+			}
+		}
+		var err error
+		step.action, err = New(stepCfg.Config, rt)
+		if err != nil {
+			p.nested(path, err)
+		}
+		a.steps = append(a.steps, step)
+	}
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Run implements the Action interface. The chain fails if the last executed step fails
+func (a *chainAction) Run(ctx context.Context, msg *model.Message) (*Result, error) {
+	result := &Result{
+		Type:    TypeChain,
+		Started: time.Now(),
+	}
+	var (
+		previous    *Result
+		previousErr error
+	)
+	stepVars := map[string]interface{}{}
+	stepMsg := *msg
+	stepMsg.Vars = map[string]interface{}{}
+	for k, v := range msg.Vars {
+		stepMsg.Vars[k] = v
+	}
+	stepMsg.Vars["steps"] = stepVars
+	for _, step := range a.steps {
+		if !step.runs(previous, previousErr) {
+			log.Infof("[%s] chain step %s skipped", msg.CorrelationID, step.name)
+			skipped := &Result{Name: step.name, Skipped: true, Started: time.Now()}
+			stepVars[step.name] = skipped.Vars()
+			result.Steps = append(result.Steps, skipped)
+			continue
+		}
+		stepResult, err := step.action.Run(ctx, &stepMsg)
+		if stepResult == nil {
+			stepResult = &Result{ExitCode: -1}
+		}
+		stepResult.Name = step.name
+		log.Infof("[%s] chain step %s (%s) finished with exit code %d after %s",
+			msg.CorrelationID, step.name, stepResult.Type, stepResult.ExitCode, stepResult.Duration)
+		if err != nil {
+			log.Warnf("[%s] chain step %s failed: %s", msg.CorrelationID, step.name, err)
+		}
+		stepVars[step.name] = stepResult.Vars()
+		stepMsg.Vars["previous"] = stepResult.Vars()
+		result.Steps = append(result.Steps, stepResult)
+		previous, previousErr = stepResult, err
+	}
+	result.Duration = time.Since(result.Started)
+	if previous != nil {
+		result.ExitCode = previous.ExitCode
+		result.StatusCode = previous.StatusCode
+		result.Stdout = previous.Stdout
+		result.Stderr = previous.Stderr
+	}
+	if previousErr != nil {
+		return result, fmt.Errorf("chain step %s failed: %s", previous.Name, previousErr)
+	}
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package action
+
+// Config represents the settings of an action. The fields used depend on the action type
+type Config struct {
+	Type              string            `yaml:"type"`
+	Cmd               string            `yaml:"cmd"`
+	HTTP              HTTPConfig        `yaml:"http"`
+	Log               LogConfig         `yaml:"log"`
+	Publish           PublishConfig     `yaml:"publish"`
+	CmdArgs           []string          `yaml:"cmdargs"`
+	Env               map[string]string `yaml:"env"`
+	Workdir           string            `yaml:"workdir"`
+	Timeout           string            `yaml:"timeout"`
+	GracePeriod       string            `yaml:"graceperiod"`
+	User              string            `yaml:"user"`
+	Group             string            `yaml:"group"`
+	Rlimits           RlimitsConfig     `yaml:"rlimits"`
+	Cgroup            string            `yaml:"cgroup"`
+	Output            OutputConfig      `yaml:"output"`
+	StdinTemplate     string            `yaml:"stdintemplate"`
+	StdinTemplateFile string            `yaml:"stdintemplate_file" mapstructure:"stdintemplate_file"`
+	TemplateDir       string            `yaml:"template_dir" mapstructure:"template_dir"`
+	// Steps are the ordered actions of a chain
+	Steps []StepConfig `yaml:"steps"`
+	// Args are the settings of action types registered by embedders
+	Args map[string]string `yaml:"args"`
+}
+
+// StepConfig represents a step of a chain. The step runs if the result of the previous
+// executed step meets all of the conditions of When
+type StepConfig struct {
+	Name   string     `yaml:"name"`
+	When   WhenConfig `yaml:"when"`
+	Config `yaml:",inline" mapstructure:",squash"`
+}
+
+// WhenConfig represents the conditions of a chain step on the previous step.
+// Status is "success", "failure" or "always". ExitCodes restricts the exit codes
+// and Output is a regular expression the stdout has to match. Status defaults to
+// "always" if ExitCodes or Output is set and to "success" otherwise
+type WhenConfig struct {
+	Status    string `yaml:"status"`
+	ExitCodes []int  `yaml:"exit_codes" mapstructure:"exit_codes"`
+	Output    string `yaml:"output"`
+}
+
+// RlimitsConfig represents the resource limits of the executed command
+type RlimitsConfig struct {
+	CPU    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+	NoFile uint64 `yaml:"nofile"`
+	NProc  uint64 `yaml:"nproc"`
+}
+
+// OutputConfig represents the capture of the command output. The limits are sizes
+// with an optional K, M or G suffix, half of a limit is retained from the beginning and
+// half of it from the end of the output. If Stream is set, output lines are logged
+type OutputConfig struct {
+	StdoutLimit string `yaml:"stdout_limit" mapstructure:"stdout_limit"`
+	StderrLimit string `yaml:"stderr_limit" mapstructure:"stderr_limit"`
+	Stream      bool   `yaml:"stream"`
+}
+
+// HTTPConfig represents the request of an http action. Method, URL, header values and body are templates
+type HTTPConfig struct {
+	Method       string            `yaml:"method"`
+	URL          string            `yaml:"url"`
+	Headers      map[string]string `yaml:"headers"`
+	Body         string            `yaml:"body"`
+	Retries      int               `yaml:"retries"`
+	RetryWait    string            `yaml:"retry_wait" mapstructure:"retry_wait"`
+	SuccessCodes []int             `yaml:"success_codes" mapstructure:"success_codes"`
+	TLS          TLSConfig         `yaml:"tls"`
+}
+
+// TLSConfig represents the TLS settings of an http action
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file" mapstructure:"ca_file"`
+	CertFile           string `yaml:"cert_file" mapstructure:"cert_file"`
+	KeyFile            string `yaml:"key_file" mapstructure:"key_file"`
+	ServerName         string `yaml:"server_name" mapstructure:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" mapstructure:"insecure_skip_verify"`
+}
+
+// LogConfig represents a log action. Message is a template, Level is one of
+// debug, info (default), warn and error
+type LogConfig struct {
+	Level   string `yaml:"level"`
+	Message string `yaml:"message"`
+}
+
+// PublishConfig represents a publish action. Subject, Sender, Recipient and Payload are
+// templates. If Payload is empty, the received payload is forwarded. The sender defaults
+// to the hostname of the subscriber. If SignKey is set, the envelope is signed
+type PublishConfig struct {
+	Subject   string `yaml:"subject"`
+	Sender    string `yaml:"sender"`
+	Recipient string `yaml:"recipient"`
+	Payload   string `yaml:"payload"`
+	SignKey   string `yaml:"signkey"`
+}
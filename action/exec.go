@@ -0,0 +1,215 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"text/template"
+	"time"
+
+	"github.com/zwopir/eventhandler/model"
+	"github.com/zwopir/eventhandler/runner"
+	"github.com/zwopir/eventhandler/templates"
+)
+
+// action types
+const (
+	TypeExec    = "exec"
+	TypeHTTP    = "http"
+	TypeLog     = "log"
+	TypeChain   = "chain"
+	TypePublish = "publish"
+)
+
+const (
+	// defaultGracePeriod is the time between SIGTERM and SIGKILL of a timed out command
+	defaultGracePeriod = "5s"
+	// defaultOutputLimit is the retained size of the command stdout and stderr
+	defaultOutputLimit = "64K"
+)
+
+// runnerAction runs a runner.Runner with the decoded payload and captures its output
+type runnerAction struct {
+	typ         string
+	runner      runner.Runner
+	stdoutLimit int
+	stderrLimit int
+	stream      bool
+}
+
+// newRunnerAction returns a runnerAction with the output settings of cfg
+func newRunnerAction(p *configParser, cfg Config, r runner.Runner) *runnerAction {
+	return &runnerAction{
+		typ:         cfg.Type,
+		runner:      r,
+		stdoutLimit: parseOutputLimit(p, "output.stdout_limit", cfg.Output.StdoutLimit),
+		stderrLimit: parseOutputLimit(p, "output.stderr_limit", cfg.Output.StderrLimit),
+		stream:      cfg.Output.Stream,
+	}
+}
+
+// Run implements the Action interface
+func (a *runnerAction) Run(ctx context.Context, msg *model.Message) (*Result, error) {
+	result := &Result{
+		Type:    a.typ,
+		Started: time.Now(),
+	}
+	if err := ctx.Err(); err != nil {
+		result.ExitCode = -1
+		return result, err
+	}
+
+	// capture the bounded output and optionally stream it to the log
+	stdoutBuffer := runner.NewCappedBuffer(a.stdoutLimit)
+	stderrBuffer := runner.NewCappedBuffer(a.stderrLimit)
+	var stdout, stderr io.Writer = stdoutBuffer, stderrBuffer
+	if a.stream {
+		stdoutLogger := runner.NewLineLogger(msg.CorrelationID, "stdout")
+		stderrLogger := runner.NewLineLogger(msg.CorrelationID, "stderr")
+		defer stdoutLogger.Flush()
+		defer stderrLogger.Flush()
+		stdout = io.MultiWriter(stdoutBuffer, stdoutLogger)
+		stderr = io.MultiWriter(stderrBuffer, stderrLogger)
+	}
+
+	err := a.runner.Run(ctx, msg.TemplatePayload(), msg.Metadata(), stdout, stderr)
+	result.Duration = time.Since(result.Started)
+	result.Stdout = stdoutBuffer.String()
+	result.Stderr = stderrBuffer.String()
+	result.ExitCode, result.StatusCode = exitStatus(err)
+	return result, err
+}
+
+// exitStatus returns the exit code and the http status code of a runner error
+func exitStatus(err error) (int, int) {
+	var (
+		exitErr   *exec.ExitError
+		statusErr *runner.HTTPStatusError
+	)
+	switch {
+	case err == nil:
+		return 0, 0
+	case errors.As(err, &exitErr) && exitErr.Exited():
+		return exitErr.ExitCode(), 0
+	case errors.As(err, &statusErr):
+		return 1, statusErr.StatusCode
+	default:
+		return -1, 0
+	}
+}
+
+// newExecAction is the Factory of TypeExec actions
+func newExecAction(cfg Config, rt Runtime) (Action, error) {
+	p := &configParser{}
+	p.required("cmd", cfg.Cmd)
+
+	// commands running longer than the timeout are terminated with SIGTERM and,
+	// if they are still running after the grace period, kill -9'ed. Signals are
+	// sent to the whole process group, so children of the command are terminated as well
+	timeout := p.duration("timeout", cfg.Timeout, "")
+	grace := p.duration("graceperiod", cfg.GracePeriod, defaultGracePeriod)
+
+	// parse the argument, environment and working directory templates. They are rendered
+	// per message, every rendered value is passed verbatim to the command
+	argTemplates := []*template.Template{}
+	for i, arg := range cfg.CmdArgs {
+		argTemplates = append(argTemplates, p.template(fmt.Sprintf("cmdargs[%d]", i), arg))
+	}
+	envTemplates := map[string]*template.Template{}
+	for _, key := range SortedKeys(cfg.Env) {
+		tmpl, err := runner.ParseEnvTemplates(map[string]string{key: cfg.Env[key]})
+		if err != nil {
+			p.add(JoinPath("env", key), err)
+			continue
+		}
+		envTemplates[key] = tmpl[key]
+	}
+	var workdirTemplate *template.Template
+	if cfg.Workdir != "" {
+		workdirTemplate = p.template("workdir", cfg.Workdir)
+	}
+
+	// parse the configured template, optionally from a file and with the named
+	// templates of the template directory
+	stdinTemplate, err := parseStdinTemplate(cfg)
+	if err != nil {
+		if cfg.StdinTemplateFile != "" {
+			p.add("stdintemplate_file", err)
+		} else {
+			p.add("stdintemplate", err)
+		}
+	}
+
+	// the user, group, resource limits and cgroup the command runs with
+	proc := newProcess(p, cfg)
+
+	pipeRunner := runner.NewPipeRunner(
+		cfg.Cmd,
+		argTemplates,
+		timeout,
+		grace,
+		proc,
+		stdinTemplate,
+	)
+	pipeRunner.EnvTemplates = envTemplates
+	pipeRunner.WorkdirTemplate = workdirTemplate
+	a := newRunnerAction(p, cfg, pipeRunner)
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// parseStdinTemplate parses the stdin template of the action config. The template is read
+// from StdinTemplateFile if set and can include the templates in TemplateDir
+func parseStdinTemplate(cfg Config) (*template.Template, error) {
+	var (
+		set *template.Template
+		err error
+	)
+	if cfg.TemplateDir != "" {
+		set, err = templates.ParseDir(cfg.TemplateDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.StdinTemplateFile != "" {
+		if cfg.StdinTemplate != "" {
+			return nil, errors.New("stdintemplate and stdintemplate_file are mutually exclusive")
+		}
+		return templates.ParseFile(set, cfg.StdinTemplateFile)
+	}
+	return templates.Parse(set, "stdinTemplate", cfg.StdinTemplate)
+}
+
+// newProcess returns the runner.Process of the action config
+func newProcess(p *configParser, cfg Config) runner.Process {
+	rlimits := runner.Rlimits{
+		NoFile: cfg.Rlimits.NoFile,
+		NProc:  cfg.Rlimits.NProc,
+	}
+	if cfg.Rlimits.CPU != "" {
+		rlimits.CPU = p.duration("rlimits.cpu", cfg.Rlimits.CPU, "")
+	}
+	rlimits.Memory = p.size("rlimits.memory", cfg.Rlimits.Memory)
+	proc, err := runner.NewProcess(cfg.User, cfg.Group, rlimits, cfg.Cgroup)
+	if err != nil {
+		// blame the user if it doesn't resolve on its own
+		path := "group"
+		if _, userErr := runner.NewProcess(cfg.User, "", runner.Rlimits{}, ""); userErr != nil {
+			path = "user"
+		}
+		p.add(path, err)
+	}
+	return proc
+}
+
+// parseOutputLimit parses the size limit of a captured output stream
+func parseOutputLimit(p *configParser, path, limit string) int {
+	if limit == "" {
+		limit = defaultOutputLimit
+	}
+	return int(p.size(path, limit))
+}
@@ -0,0 +1,51 @@
+package action
+
+import (
+	"net/http"
+
+	"github.com/zwopir/eventhandler/runner"
+)
+
+// defaultRetryWait is the wait before the first retry of a failed http request
+const defaultRetryWait = "1s"
+
+// newHTTPAction is the Factory of TypeHTTP actions. The timeout applies to every single attempt
+func newHTTPAction(cfg Config, rt Runtime) (Action, error) {
+	p := &configParser{}
+	timeout := p.duration("timeout", cfg.Timeout, "")
+	httpCfg := cfg.HTTP
+	tlsConfig, err := runner.NewTLSConfig(
+		httpCfg.TLS.CAFile,
+		httpCfg.TLS.CertFile,
+		httpCfg.TLS.KeyFile,
+		httpCfg.TLS.ServerName,
+		httpCfg.TLS.InsecureSkipVerify,
+	)
+	if err != nil {
+		p.add("http.tls", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if httpCfg.Method == "" {
+		httpCfg.Method = http.MethodPost
+	}
+	p.required("http.url", httpCfg.URL)
+	httpRunner := &runner.HTTPRunner{
+		Client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		MethodTemplate:  p.template("http.method", httpCfg.Method),
+		URLTemplate:     p.template("http.url", httpCfg.URL),
+		HeaderTemplates: p.templates("http.headers", httpCfg.Headers),
+		BodyTemplate:    p.template("http.body", httpCfg.Body),
+		Retries:         httpCfg.Retries,
+		RetryWait:       p.duration("http.retry_wait", httpCfg.RetryWait, defaultRetryWait),
+		SuccessCodes:    httpCfg.SuccessCodes,
+	}
+	a := newRunnerAction(p, cfg, httpRunner)
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,77 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/zwopir/eventhandler/model"
+	"github.com/zwopir/eventhandler/runner"
+)
+
+// defaultLogMessage is the message template of a log action if none is configured
+const defaultLogMessage = `{{ toJson . }}`
+
+// logAction logs the rendered message template
+type logAction struct {
+	logf    func(format string, args ...interface{})
+	message *template.Template
+}
+
+// newLogAction is the Factory of TypeLog actions
+func newLogAction(cfg Config, rt Runtime) (Action, error) {
+	p := &configParser{}
+	logf, err := logFunc(cfg.Log.Level)
+	if err != nil {
+		p.add("log.level", err)
+	}
+	message := cfg.Log.Message
+	if message == "" {
+		message = defaultLogMessage
+	}
+	a := &logAction{
+		logf:    logf,
+		message: p.template("log.message", message),
+	}
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// logFunc returns the log function of the level
+func logFunc(level string) (func(format string, args ...interface{}), error) {
+	switch level {
+	case "debug":
+		return log.Debugf, nil
+	case "", "info":
+		return log.Infof, nil
+	case "warn":
+		return log.Warnf, nil
+	case "error":
+		return log.Errorf, nil
+	}
+	return nil, fmt.Errorf("unknown log level %q", level)
+}
+
+// Run implements the Action interface. The message template is rendered with the
+// keys of the payload and the envelope metadata as .envelope
+func (a *logAction) Run(ctx context.Context, msg *model.Message) (*Result, error) {
+	result := &Result{
+		Type:    TypeLog,
+		Started: time.Now(),
+	}
+	b := new(bytes.Buffer)
+	err := a.message.Execute(b, runner.TemplateData(msg.TemplatePayload(), msg.Metadata()))
+	result.Duration = time.Since(result.Started)
+	if err != nil {
+		result.ExitCode = 1
+		return result, err
+	}
+	a.logf("[%s] %s", msg.CorrelationID, b.String())
+	result.Stdout = b.String()
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package action
+
+import (
+	"bytes"
+
+	"github.com/zwopir/eventhandler/model"
+	"github.com/zwopir/eventhandler/runner"
+)
+
+// Preview represents what an action would do with a message
+type Preview struct {
+	// Type is the action type, i.e. "exec"
+	Type string `json:"type"`
+	// Name is the name of a chain step
+	Name string `json:"name,omitempty"`
+	// Rendering are the rendered templates of exec and http actions
+	Rendering *runner.Rendering `json:"rendering,omitempty"`
+	// Message is the rendered message of a log action
+	Message string `json:"message,omitempty"`
+	// Subject, Sender, Recipient and Payload are the rendered envelope of a publish action
+	Subject   string `json:"subject,omitempty"`
+	Sender    string `json:"sender,omitempty"`
+	Recipient string `json:"recipient,omitempty"`
+	Payload   string `json:"payload,omitempty"`
+	// Steps are the previews of all steps of a chain
+	Steps []*Preview `json:"steps,omitempty"`
+	// Error is the rendering error of a chain step
+	Error string `json:"error,omitempty"`
+}
+
+// Previewer is implemented by actions that can render a message without running
+type Previewer interface {
+	// Preview renders the message without side effects
+	Preview(msg *model.Message) (*Preview, error)
+}
+
+// Preview implements the Previewer interface if the runner implements runner.Renderer
+func (a *runnerAction) Preview(msg *model.Message) (*Preview, error) {
+	p := &Preview{Type: a.typ}
+	renderer, ok := a.runner.(runner.Renderer)
+	if !ok {
+		return p, nil
+	}
+	var err error
+	p.Rendering, err = renderer.Render(msg.TemplatePayload(), msg.Metadata())
+	return p, err
+}
+
+// Preview implements the Previewer interface
+func (a *logAction) Preview(msg *model.Message) (*Preview, error) {
+	b := new(bytes.Buffer)
+	err := a.message.Execute(b, runner.TemplateData(msg.TemplatePayload(), msg.Metadata()))
+	return &Preview{Type: TypeLog, Message: b.String()}, err
+}
+
+// Preview implements the Previewer interface
+func (a *publishAction) Preview(msg *model.Message) (*Preview, error) {
+	p := &Preview{Type: TypePublish}
+	subject, envelope, err := a.render(msg)
+	if err != nil {
+		return p, err
+	}
+	p.Subject = subject
+	p.Sender = string(envelope.Sender)
+	p.Recipient = string(envelope.Recipient)
+	p.Payload = string(envelope.Payload)
+	return p, nil
+}
+
+// Preview implements the Previewer interface. Step conditions depend on the results of
+// the previous steps, so every step is rendered as if the previous steps succeeded
+// with empty output
+func (a *chainAction) Preview(msg *model.Message) (*Preview, error) {
+	p := &Preview{Type: TypeChain}
+	stepVars := map[string]interface{}{}
+	stepMsg := *msg
+	stepMsg.Vars = map[string]interface{}{}
+	for k, v := range msg.Vars {
+		stepMsg.Vars[k] = v
+	}
+	stepMsg.Vars["steps"] = stepVars
+	for _, step := range a.steps {
+		stepPreview := &Preview{}
+		if previewer, ok := step.action.(Previewer); ok {
+			var err error
+			stepPreview, err = previewer.Preview(&stepMsg)
+			if stepPreview == nil {
+				stepPreview = &Preview{}
+			}
+			if err != nil {
+				stepPreview.Error = err.Error()
+			}
+		}
+		stepPreview.Name = step.name
+		p.Steps = append(p.Steps, stepPreview)
+		stepResult := &Result{Type: stepPreview.Type, Name: step.name}
+		stepVars[step.name] = stepResult.Vars()
+		stepMsg.Vars["previous"] = stepResult.Vars()
+	}
+	return p, nil
+}
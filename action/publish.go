@@ -0,0 +1,183 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nats-io/go-nats"
+	"github.com/nats-io/go-nats/encoders/protobuf"
+	"github.com/prometheus/common/log"
+	"github.com/satori/go.uuid"
+	"github.com/zwopir/eventhandler/model"
+	"github.com/zwopir/eventhandler/runner"
+	"github.com/zwopir/eventhandler/verify"
+)
+
+// publisher publishes an encoded message, i.e. a protobuf encoded nats connection
+type publisher interface {
+	Publish(subject string, v interface{}) error
+}
+
+// publishAction publishes a new envelope rendered from the received message
+type publishAction struct {
+	publisher publisher
+	subject   *template.Template
+	sender    *template.Template
+	recipient *template.Template
+	payload   *template.Template
+	signer    *verify.Signer
+}
+
+// newPublishAction is the Factory of TypePublish actions
+// Without a nats connection the action can only be previewed
+func newPublishAction(cfg Config, rt Runtime) (Action, error) {
+	if rt.Conn == nil || rt.DryRun {
+		return newPublishActionWithPublisher(cfg.Publish, rt.Hostname, nil)
+	}
+	a, err := newPublishActionWithPublisher(cfg.Publish, rt.Hostname, nil)
+	if err != nil {
+		return nil, err
+	}
+	a.publisher, err = nats.NewEncodedConn(rt.Conn, protobuf.PROTOBUF_ENCODER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encoded nats connection: %s", err)
+	}
+	return a, nil
+}
+
+// newPublishActionWithPublisher parses the publish config into a publishAction
+func newPublishActionWithPublisher(cfg PublishConfig, hostname string, pub publisher) (*publishAction, error) {
+	p := &configParser{}
+	p.required("publish.subject", cfg.Subject)
+	p.required("publish.recipient", cfg.Recipient)
+	if cfg.Sender == "" {
+		cfg.Sender = hostname
+	}
+	a := &publishAction{publisher: pub}
+	for _, t := range []struct {
+		tmpl **template.Template
+		name string
+		text string
+	}{
+		{&a.subject, "subject", cfg.Subject},
+		{&a.sender, "sender", cfg.Sender},
+		{&a.recipient, "recipient", cfg.Recipient},
+		{&a.payload, "payload", cfg.Payload},
+	} {
+		if t.text != "" {
+			*t.tmpl = p.template(JoinPath("publish", t.name), t.text)
+		}
+	}
+	if cfg.SignKey != "" {
+		a.signer = newSigner(p, "publish.signkey", cfg.SignKey)
+	}
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newSigner reads the private key of the signer from keyFile
+func newSigner(p *configParser, path, keyFile string) *verify.Signer {
+	keyring, err := os.Open(keyFile)
+	if err != nil {
+		p.add(path, err)
+		return nil
+	}
+	defer keyring.Close()
+	signer, err := verify.NewSigner(keyring)
+	if err != nil {
+		p.errorf(path, "failed to read private key: %s", err)
+	}
+	return signer
+}
+
+// Run implements the Action interface. The published envelope gets a new correlation ID,
+// the correlation ID of the received message is kept as parent correlation ID
+func (a *publishAction) Run(ctx context.Context, msg *model.Message) (*Result, error) {
+	result := &Result{
+		Type:    TypePublish,
+		Started: time.Now(),
+	}
+	if a.publisher == nil {
+		result.ExitCode = 1
+		return result, errors.New("publish action requires a nats connection")
+	}
+	subject, envelope, err := a.render(msg)
+	if err == nil {
+		err = a.publisher.Publish(subject, envelope)
+	}
+	result.Duration = time.Since(result.Started)
+	if err != nil {
+		result.ExitCode = 1
+		return result, err
+	}
+	correlationID := model.CorrelationIDString(envelope.CorrelationId)
+	log.Infof("[%s] published message %s on %s", msg.CorrelationID, correlationID, subject)
+	result.Stdout = correlationID
+	return result, nil
+}
+
+// render renders the subject and the envelope to publish
+func (a *publishAction) render(msg *model.Message) (string, *model.Envelope, error) {
+	data := runner.TemplateData(msg.TemplatePayload(), msg.Metadata())
+	values := map[string]string{}
+	for name, tmpl := range map[string]*template.Template{
+		"subject":   a.subject,
+		"sender":    a.sender,
+		"recipient": a.recipient,
+		"payload":   a.payload,
+	} {
+		if tmpl == nil {
+			continue
+		}
+		b := new(bytes.Buffer)
+		err := tmpl.Execute(b, data)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to render publish %s: %s", name, err)
+		}
+		values[name] = b.String()
+	}
+	subject := strings.TrimSpace(values["subject"])
+	if subject == "" {
+		return "", nil, errors.New("publish subject rendered empty")
+	}
+	payload := msg.Envelope.Payload
+	if a.payload != nil {
+		payload = []byte(values["payload"])
+		// make sure the payload can be unmarshaled in the subscriber
+		_, err := model.DecodePayload(payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("rendered payload is not json unmarshalable: %s", err)
+		}
+	}
+	correlationID, err := uuid.NewV4()
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to generate correlation ID: %s", err)
+	}
+	envelope := &model.Envelope{
+		Sender:              []byte(values["sender"]),
+		Recipient:           []byte(values["recipient"]),
+		Payload:             payload,
+		CorrelationId:       correlationID.Bytes(),
+		ParentCorrelationId: msg.Envelope.CorrelationId,
+		CreatedAt:           time.Now().UnixNano(),
+	}
+	if a.signer != nil {
+		signBuffer := new(bytes.Buffer)
+		signBuffer.Write(envelope.Sender)
+		signBuffer.Write(envelope.Recipient)
+		signBuffer.Write(envelope.Payload)
+		envelope.Signature, err = a.signer.Sign(signBuffer)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to sign message: %s", err)
+		}
+	}
+	return subject, envelope, nil
+}
@@ -0,0 +1,89 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/zwopir/eventhandler/model"
+	"github.com/zwopir/eventhandler/verify"
+)
+
+type testPublisher struct {
+	subject  string
+	envelope *model.Envelope
+}
+
+func (p *testPublisher) Publish(subject string, v interface{}) error {
+	p.subject = subject
+	p.envelope = v.(*model.Envelope)
+	return nil
+}
+
+func TestPublishAction_Run(t *testing.T) {
+	p := &testPublisher{}
+	a, err := newPublishActionWithPublisher(PublishConfig{
+		Subject:   "eventhandler.{{ .site }}",
+		Recipient: "{{ .site }}.example.com",
+		Payload:   `{"check_name":"{{ .check_name }}","origin":"{{ .envelope.sender }}"}`,
+		SignKey:   "../verify/testdata/private.key",
+	}, "central.example.com", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := createTestMessage(`{"site":"berlin","check_name":"check_foo"}`)
+	result, err := a.Run(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := p.envelope
+	if p.subject != "eventhandler.berlin" {
+		t.Errorf("expected subject eventhandler.berlin, got %s", p.subject)
+	}
+	if string(e.Sender) != "central.example.com" || string(e.Recipient) != "berlin.example.com" {
+		t.Errorf("unexpected sender %s or recipient %s", e.Sender, e.Recipient)
+	}
+	if string(e.Payload) != `{"check_name":"check_foo","origin":"testSender"}` {
+		t.Errorf("unexpected payload %s", e.Payload)
+	}
+	if string(e.ParentCorrelationId) != "testUUID" {
+		t.Errorf("expected parent correlation ID testUUID, got %s", e.ParentCorrelationId)
+	}
+	if result.Stdout != model.CorrelationIDString(e.CorrelationId) {
+		t.Errorf("expected the new correlation ID as result, got %s", result.Stdout)
+	}
+	keyring, err := os.Open("../verify/testdata/public.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keyring.Close()
+	verifier, err := verify.NewVerifier(keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := bytes.Join([][]byte{e.Sender, e.Recipient, e.Payload}, nil)
+	if err := verifier.Verify(signed, e.Signature); err != nil {
+		t.Errorf("failed to verify the signature of the published envelope: %s", err)
+	}
+}
+
+func TestPublishAction_Run2(t *testing.T) {
+	p := &testPublisher{}
+	a, err := newPublishActionWithPublisher(PublishConfig{
+		Subject:   "eventhandler.forward",
+		Recipient: "{{ .envelope.recipient }}",
+		Payload:   `{{ .check_name }}`,
+	}, "central.example.com", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.Run(context.Background(), createTestMessage(`{"check_name":"check_foo"}`))
+	if err == nil {
+		t.Error("expected a payload that isn't json to fail")
+	}
+	_, err = newPublishActionWithPublisher(PublishConfig{Recipient: "me"}, "", p)
+	if err == nil {
+		t.Error("expected a missing subject to fail")
+	}
+}
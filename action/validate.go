@@ -0,0 +1,169 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/zwopir/eventhandler/runner"
+	"github.com/zwopir/eventhandler/templates"
+)
+
+// ConfigError represents an invalid setting of an action config
+type ConfigError struct {
+	// Path is the yaml path of the setting relative to the action config, i.e. "steps[1].timeout"
+	Path string
+	Err  error
+}
+
+// Error implements the error interface
+func (e *ConfigError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+// ConfigErrors is returned by the factories of the built-in action types and lists all
+// invalid settings of the action config
+type ConfigErrors []*ConfigError
+
+// Error implements the error interface
+func (e ConfigErrors) Error() string {
+	msgs := []string{}
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate creates the action without the resources of a subscriber and returns all invalid
+// settings. Factories are called with Runtime.DryRun, so validation and New can't disagree.
+// Action types registered by embedders report a single error unless they return ConfigErrors
+func Validate(cfg Config) []*ConfigError {
+	_, err := New(cfg, Runtime{DryRun: true})
+	return configErrors(err)
+}
+
+// configErrors returns the invalid settings of an error returned by New
+func configErrors(err error) []*ConfigError {
+	var (
+		errs      ConfigErrors
+		configErr *ConfigError
+	)
+	switch {
+	case err == nil:
+		return []*ConfigError{}
+	case errors.As(err, &errs):
+		return errs
+	case errors.As(err, &configErr):
+		return []*ConfigError{configErr}
+	default:
+		return []*ConfigError{{Err: err}}
+	}
+}
+
+// JoinPath returns the yaml path of key below path
+func JoinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// configParser parses the settings of an action config. It collects all invalid settings
+// instead of stopping at the first one
+type configParser struct {
+	errors ConfigErrors
+}
+
+func (p *configParser) add(path string, err error) {
+	p.errors = append(p.errors, &ConfigError{Path: path, Err: err})
+}
+
+func (p *configParser) errorf(path, format string, args ...interface{}) {
+	p.add(path, fmt.Errorf(format, args...))
+}
+
+// nested adds the invalid settings of the nested action config at path
+func (p *configParser) nested(path string, err error) {
+	for _, e := range configErrors(err) {
+		p.add(JoinPath(path, e.Path), e.Err)
+	}
+}
+
+// err returns the collected errors or nil if all settings are valid
+func (p *configParser) err() error {
+	if len(p.errors) == 0 {
+		return nil
+	}
+	return p.errors
+}
+
+// required adds an error and returns false if the value is empty
+func (p *configParser) required(path, value string) bool {
+	if value == "" {
+		p.add(path, errors.New("mandatory setting is missing"))
+		return false
+	}
+	return true
+}
+
+// template parses text as template named after the path
+func (p *configParser) template(path, text string) *template.Template {
+	tmpl, err := templates.New(path).Parse(text)
+	if err != nil {
+		p.errorf(path, "failed to parse template: %s", err)
+	}
+	return tmpl
+}
+
+// templates parses the template values of a map in key order
+func (p *configParser) templates(path string, m map[string]string) map[string]*template.Template {
+	ret := map[string]*template.Template{}
+	for _, key := range SortedKeys(m) {
+		ret[key] = p.template(JoinPath(path, key), m[key])
+	}
+	return ret
+}
+
+// duration parses value as duration. An empty value is parsed as fallback and is
+// missing if there is no fallback
+func (p *configParser) duration(path, value, fallback string) time.Duration {
+	if value == "" {
+		value = fallback
+	}
+	if !p.required(path, value) {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		p.add(path, err)
+	}
+	return d
+}
+
+// size parses an optional value as size
+func (p *configParser) size(path, value string) uint64 {
+	if value == "" {
+		return 0
+	}
+	size, err := runner.ParseSize(value)
+	if err != nil {
+		p.add(path, err)
+	}
+	return size
+}
+
+// SortedKeys returns the sorted keys of a yaml map
+func SortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nats-io/go-nats"
+	"github.com/prometheus/common/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/machine"
+)
+
+var (
+	ctlHost     string
+	ctlHandler  string
+	ctlTimeout  time.Duration
+	ctlDuration time.Duration
+)
+
+// ctlCmd represents the ctl command
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Query and control running subscribers",
+	Long: `Query and control running subscribers.
+
+Requests are sent to the control subject of the subscriber with the identity --host or,
+if --host is empty, to all subscribers. All replies received within --timeout are rendered.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// bind the flags at runtime, the keys are shared with other commands
+		viper.BindPFlag("nats_url", cmd.Flags().Lookup("nats_url"))
+		viper.BindPFlag("control_subject", cmd.Flags().Lookup("control_subject"))
+	},
+}
+
+// newCtlSubCmd returns the ctl sub command that sends the control command
+func newCtlSubCmd(command string) *cobra.Command {
+	return &cobra.Command{
+		Use:   command,
+		Short: fmt.Sprintf("Send a %s request to running subscribers", command),
+		Run: func(cmd *cobra.Command, args []string) {
+			msg := &machine.ControlMessage{
+				Command: command,
+				Handler: ctlHandler,
+			}
+			if command == machine.ControlMute {
+				msg.Duration = ctlDuration.String()
+			}
+			replies, err := sendControlMessage(msg, ctlHost, ctlTimeout)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(replies) == 0 {
+				log.Fatalf("no subscriber replied within %s", ctlTimeout)
+			}
+			renderControlReplies(os.Stdout, replies)
+		},
+	}
+}
+
+// sendControlMessage sends msg as request to the control subject of host, or to all subscribers
+// if host is empty. It returns all replies received within timeout. Requests to a single host
+// return after the first reply
+func sendControlMessage(msg *machine.ControlMessage, host string, timeout time.Duration) ([]machine.ControlReply, error) {
+	natsUrl := viper.GetString("nats_url")
+	subject := viper.GetString("control_subject")
+	if host != "" {
+		subject = subject + "." + host
+	}
+	nc, err := nats.Connect(natsUrl)
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to nats server at %s: %s", natsUrl, err)
+	}
+	defer nc.Close()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	inbox := nats.NewInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+	err = nc.PublishRequest(subject, inbox, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish control message: %s", err)
+	}
+
+	replies := []machine.ControlReply{}
+	deadline := time.Now().Add(timeout)
+	for {
+		m, err := sub.NextMsg(deadline.Sub(time.Now()))
+		if err == nats.ErrTimeout {
+			return replies, nil
+		}
+		if err != nil {
+			return replies, err
+		}
+		reply := machine.ControlReply{}
+		err = json.Unmarshal(m.Data, &reply)
+		if err != nil {
+			log.Errorf("failed to unmarshal control reply: %s", err)
+			continue
+		}
+		replies = append(replies, reply)
+		if host != "" {
+			return replies, nil
+		}
+	}
+}
+
+// renderControlReplies writes the replies as human readable table to w
+func renderControlReplies(w io.Writer, replies []machine.ControlReply) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	for _, r := range replies {
+		fmt.Fprintf(tw, "%s/%s\t%s\n", r.Host, r.Handler, r.Command)
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(tw, "  error\t%s\n", r.Error)
+		case r.Status != nil:
+			s := r.Status
+			fmt.Fprintf(tw, "  started\t%s\n", s.Started.Format(time.RFC3339))
+			fmt.Fprintf(tw, "  uptime\t%s\n", s.Uptime)
+			fmt.Fprintf(tw, "  config hash\t%s\n", s.ConfigHash)
+			fmt.Fprintf(tw, "  paused\t%t\n", s.Paused)
+			if !s.MutedUntil.IsZero() {
+				fmt.Fprintf(tw, "  muted until\t%s\n", s.MutedUntil.Format(time.RFC3339))
+			}
+			if s.Maintenance != "" {
+				fmt.Fprintf(tw, "  maintenance\t%s\n", s.Maintenance)
+			}
+			if !s.BlackoutUntil.IsZero() {
+				fmt.Fprintf(tw, "  blackout until\t%s\n", s.BlackoutUntil.Format(time.RFC3339))
+			}
+			fmt.Fprintf(tw, "  dispatches\t%d/%d\n", s.Dispatches, s.MaxDispatches)
+			renderCounters(tw, s.Counters)
+		case r.Counters != nil:
+			renderCounters(tw, *r.Counters)
+		case r.ConfigHash != "":
+			fmt.Fprintf(tw, "  config hash\t%s\n", r.ConfigHash)
+		case r.Uptime != "":
+			fmt.Fprintf(tw, "  uptime\t%s\n", r.Uptime)
+		case r.Trace != nil:
+			fmt.Fprintf(tw, "  message\t%s\n", r.Trace.CorrelationID)
+			fmt.Fprintf(tw, "  subject\t%s\n", r.Trace.Subject)
+			fmt.Fprintf(tw, "  received\t%s\n", r.Trace.Received.Format(time.RFC3339))
+			fmt.Fprintf(tw, "  matched\t%t\n", r.Trace.Matched)
+			renderTrace(tw, r.Trace.Filters)
+		}
+	}
+}
+
+// renderTrace writes the filter trace to w
+func renderTrace(w io.Writer, trace filter.Trace) {
+	for _, entry := range trace {
+		fmt.Fprintf(w, "  filter\t%s\n", entry)
+	}
+}
+
+// renderCounters writes the counters to w
+func renderCounters(w io.Writer, c machine.Counters) {
+	fmt.Fprintf(w, "  received\t%d\n", c.Received)
+	fmt.Fprintf(w, "  matched\t%d\n", c.Matched)
+	fmt.Fprintf(w, "  filtered\t%d\n", c.Filtered)
+	fmt.Fprintf(w, "  discarded\t%d\n", c.Discarded)
+	fmt.Fprintf(w, "  dispatched\t%d\n", c.Dispatched)
+	fmt.Fprintf(w, "  failed\t%d\n", c.Failed)
+	fmt.Fprintf(w, "  errors\t%d\n", c.Errors)
+	names := []string{}
+	for name := range c.Rejected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  rejected by %s\t%d\n", name, c.Rejected[name])
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(ctlCmd)
+
+	ctlCmd.PersistentFlags().String("nats_url", nats.DefaultURL, "nats url")
+	ctlCmd.PersistentFlags().String("control_subject", machine.DefaultControlSubject, "nats subject for control messages")
+
+	// request parameters are not viper config values
+	ctlCmd.PersistentFlags().StringVar(&ctlHost, "host", "", "identity of the subscriber, its hostname unless configured (default all subscribers)")
+	ctlCmd.PersistentFlags().StringVar(&ctlHandler, "handler", "", "name of the handler (default all handlers)")
+	ctlCmd.PersistentFlags().DurationVar(&ctlTimeout, "timeout", 2*time.Second, "time to wait for replies")
+
+	for _, command := range machine.ControlCommands {
+		subCmd := newCtlSubCmd(command)
+		if command == machine.ControlMute {
+			subCmd.Flags().DurationVar(&ctlDuration, "for", time.Hour, "mute duration, 0 lifts the mute")
+		}
+		ctlCmd.AddCommand(subCmd)
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/prometheus/common/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/model"
+)
+
+var (
+	explainSender    string
+	explainRecipient string
+	explainSubject   string
+	explainPayload   string
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Evaluate the configured filters with a message without dispatching it",
+	Long: `Evaluate the configured filters with a message without dispatching it.
+
+The message is built from --payload, --sender, --recipient and --subject. Sender, recipient
+and subject default to the values of the config. Every filter is printed with the value it
+retrieved and its result. The command exits with status 1 if the message doesn't match.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if explainPayload == "" {
+			log.Fatal("payload is a mandatory parameter")
+		}
+		for flag, value := range map[string]*string{
+			"sender":    &explainSender,
+			"recipient": &explainRecipient,
+			"subject":   &explainSubject,
+		} {
+			if !cmd.Flags().Changed(flag) {
+				*value = viper.GetString(flag)
+			}
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("failed to determine hostname: %s", err)
+		}
+		identity := subscriberIdentity(hostname)
+		filters, err := newFilters(identity)
+		if err != nil {
+			log.Fatal(err)
+		}
+		msg, err := model.NewMessage(model.Envelope{
+			Sender:    []byte(explainSender),
+			Recipient: []byte(explainRecipient),
+			Payload:   []byte(explainPayload),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		msg.Subject = explainSubject
+		matched, trace, err := filter.Explain(filters, msg)
+		renderExplanation(os.Stdout, matched, trace, err)
+		if !matched {
+			os.Exit(1)
+		}
+	},
+}
+
+// renderExplanation writes the result of a filter evaluation as human readable table to w
+func renderExplanation(w io.Writer, matched bool, trace filter.Trace, err error) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	renderTrace(tw, trace)
+	if err != nil {
+		fmt.Fprintf(tw, "  error\t%s\n", err)
+	}
+	fmt.Fprintf(tw, "  matched\t%t\n", matched)
+}
+
+func init() {
+	RootCmd.AddCommand(explainCmd)
+
+	// message parameters are not viper config values
+	explainCmd.Flags().StringVar(&explainSender, "sender", "", "sender of the message (default sender of the config)")
+	explainCmd.Flags().StringVar(&explainRecipient, "recipient", "", "recipient of the message (default recipient of the config)")
+	explainCmd.Flags().StringVar(&explainSubject, "subject", "", "subject the message is received on (default subject of the config)")
+	explainCmd.Flags().StringVar(&explainPayload, "payload", "", "message payload")
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/nats-io/go-nats"
+	"github.com/prometheus/common/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zwopir/eventhandler/machine"
+)
+
+var (
+	muteHost     string
+	muteHandler  string
+	muteDuration time.Duration
+	muteTimeout  time.Duration
+)
+
+// muteCmd represents the mute command
+var muteCmd = &cobra.Command{
+	Use:   "mute",
+	Short: "Temporarily suppress the dispatching of running subscribers",
+	Long: `Temporarily suppress the dispatching of running subscribers.
+
+The mute is sent to the subscriber with the identity --host, or to all subscribers if --host is empty.
+Only the subscribers whose handler name matches --handler apply it, or all subscribers if
+--handler is empty. A duration of 0 lifts an active mute.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		// bind the flags at runtime, the keys are shared with other commands
+		viper.BindPFlag("nats_url", cmd.Flags().Lookup("nats_url"))
+		viper.BindPFlag("control_subject", cmd.Flags().Lookup("control_subject"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		msg := &machine.ControlMessage{
+			Command:  machine.ControlMute,
+			Handler:  muteHandler,
+			Duration: muteDuration.String(),
+		}
+		replies, err := sendControlMessage(msg, muteHost, muteTimeout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(replies) == 0 {
+			log.Fatalf("no subscriber acknowledged the mute within %s", muteTimeout)
+		}
+		renderControlReplies(os.Stdout, replies)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(muteCmd)
+
+	muteCmd.Flags().String("nats_url", nats.DefaultURL, "nats url")
+	muteCmd.Flags().String("control_subject", machine.DefaultControlSubject, "nats subject for control messages")
+
+	// mute parameters are not viper config values
+	muteCmd.Flags().StringVar(&muteHost, "host", "", "identity of the subscriber, its hostname unless configured (default all subscribers)")
+	muteCmd.Flags().StringVar(&muteHandler, "handler", "", "name of the handler to mute (default all handlers)")
+	muteCmd.Flags().DurationVar(&muteDuration, "for", time.Hour, "mute duration")
+	muteCmd.Flags().DurationVar(&muteTimeout, "timeout", 2*time.Second, "time to wait for acknowledgements")
+}
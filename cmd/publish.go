@@ -2,19 +2,28 @@ package cmd
 
 import (
 	"bytes"
-	"encoding/json"
-	"github.com/zwopir/eventhandler/model"
-	"github.com/zwopir/eventhandler/verify"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/nats-io/go-nats"
 	"github.com/nats-io/go-nats/encoders/protobuf"
 	"github.com/prometheus/common/log"
 	"github.com/satori/go.uuid"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"os"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/model"
+	"github.com/zwopir/eventhandler/runner"
+	"github.com/zwopir/eventhandler/templates"
+	"github.com/zwopir/eventhandler/verify"
 )
 
-var payload string
+var (
+	payload string
+	group   string
+)
 
 // publishCmd represents the publish command
 var publishCmd = &cobra.Command{
@@ -22,8 +31,18 @@ var publishCmd = &cobra.Command{
 	Short: "Publish a message to the eventhandler queue",
 	Long: `Publish a messsage to the eventhandler queue.
 
-The payload must be a hash of strings
-formatted as json (for example {"check_name":"check_connection"})`,
+The payload must be json, for example {"check_name":"check_connection"}
+or {"service":{"name":"http","tags":["web"]},"attempt":3}.
+The recipient is the identity of a subscriber, "*" for all subscribers or,
+with --group, a group of subscribers.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		// bind the flags at runtime, the keys are shared with other commands
+		viper.BindPFlag("sender", cmd.Flags().Lookup("sender"))
+		viper.BindPFlag("recipient", cmd.Flags().Lookup("recipient"))
+		viper.BindPFlag("signkey", cmd.Flags().Lookup("signkey"))
+		viper.BindPFlag("subject", cmd.Flags().Lookup("subject"))
+		viper.BindPFlag("nats_url", cmd.Flags().Lookup("nats_url"))
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// get config values
 		sender := viper.GetString("sender")
@@ -32,6 +51,11 @@ formatted as json (for example {"check_name":"check_connection"})`,
 		natsUrl := viper.GetString("nats_url")
 		subject := viper.GetString("subject")
 
+		// address a group instead of a single recipient
+		if group != "" {
+			recipient = filter.RecipientGroupPrefix + group
+		}
+
 		// validate payload
 		if payload == "" {
 			log.Fatal("payload is a mandatory parameter")
@@ -51,23 +75,18 @@ formatted as json (for example {"check_name":"check_connection"})`,
 			}
 			signMessage = true
 		}
-		nc, err := nats.Connect(natsUrl)
-		if err != nil {
-			log.Fatalf("can't connect to nats server at %s: %s", natsUrl, err)
-		}
-		defer nc.Close()
 
 		// unmarshal payload to make sure it can be unmarshaled in subscriber
 		// the unmarshaled data is discarded
-		var payloadData interface{}
-		err = json.Unmarshal([]byte(payload), &payloadData)
+		payloadData, err := model.DecodePayload([]byte(payload))
 		if err != nil {
 			log.Fatalf("payload %v is not json unmarshalable", payload)
 		}
-		// protobuf encode message in the nats queue
-		encConn, err := nats.NewEncodedConn(nc, protobuf.PROTOBUF_ENCODER)
+		// the subject may be a template, it is rendered with the payload keys and the
+		// sender and recipient
+		subject, err = renderSubject(subject, sender, recipient, payloadData)
 		if err != nil {
-			log.Fatalf("failed to create encoded nats connection: %s", err)
+			log.Fatalf("failed to render subject: %s", err)
 		}
 
 		// calculate signature if requested
@@ -95,16 +114,65 @@ formatted as json (for example {"check_name":"check_connection"})`,
 			Payload:       []byte(payload),
 			Signature:     signature,
 			CorrelationId: correlationID.Bytes(),
+			CreatedAt:     time.Now().UnixNano(),
 		}
 		log.Debugf("sending message %s", msg.String())
-		err = encConn.Publish(subject, msg)
+		err = publishEnvelope(natsUrl, subject, msg)
 		if err != nil {
-			log.Fatalf("failed to publish message: %s", err)
+			log.Fatal(err)
 		}
-		log.Infof("sent message with id %s", correlationID)
+		log.Infof("sent message with id %s on %s", correlationID, subject)
 	},
 }
 
+// publishEnvelope publishes the protobuf encoded envelope on subject to the nats server
+// at natsUrl. It is replaced in tests
+var publishEnvelope = func(natsUrl, subject string, msg *model.Envelope) error {
+	nc, err := nats.Connect(natsUrl)
+	if err != nil {
+		return fmt.Errorf("can't connect to nats server at %s: %s", natsUrl, err)
+	}
+	defer nc.Close()
+	encConn, err := nats.NewEncodedConn(nc, protobuf.PROTOBUF_ENCODER)
+	if err != nil {
+		return fmt.Errorf("failed to create encoded nats connection: %s", err)
+	}
+	err = encConn.Publish(subject, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %s", err)
+	}
+	return nil
+}
+
+// renderSubject renders the subject template. The template data are the keys of a json
+// object payload, .sender and .recipient unless the payload sets them, and the envelope
+// metadata as .envelope
+func renderSubject(subject, sender, recipient string, payloadData interface{}) (string, error) {
+	tmpl, err := templates.New("subject").Parse(subject)
+	if err != nil {
+		return "", err
+	}
+	data := runner.TemplateData(payloadData, runner.Metadata{
+		"sender":    sender,
+		"recipient": recipient,
+	})
+	for key, value := range map[string]string{"sender": sender, "recipient": recipient} {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+	b := new(bytes.Buffer)
+	err = tmpl.Execute(b, data)
+	if err != nil {
+		return "", err
+	}
+	rendered := strings.TrimSpace(b.String())
+	if rendered == "" || strings.ContainsAny(rendered, " \t*>") {
+		return "", fmt.Errorf("rendered subject %q is not a valid nats subject", rendered)
+	}
+	return rendered, nil
+}
+
 func init() {
 	RootCmd.AddCommand(publishCmd)
 
@@ -112,17 +180,11 @@ func init() {
 	publishCmd.Flags().String("sender", "localhost", "sender name")
 	publishCmd.Flags().String("recipient", "localhost", "recipient name")
 	publishCmd.Flags().String("signkey", "", "private key file for message signing")
-	publishCmd.Flags().String("subject", "eventhandler", "nats subject")
+	publishCmd.Flags().String("subject", "eventhandler", "nats subject, may be a template (i.e. eventhandler.{{.recipient}})")
 	publishCmd.Flags().String("nats_url", nats.DefaultURL, "nats url")
 
-	// bind cobra flags to viper
-	viper.BindPFlag("sender", publishCmd.Flags().Lookup("sender"))
-	viper.BindPFlag("recipient", publishCmd.Flags().Lookup("recipient"))
-	viper.BindPFlag("signkey", publishCmd.Flags().Lookup("signkey"))
-	viper.BindPFlag("subject", publishCmd.Flags().Lookup("subject"))
-	viper.BindPFlag("nats_url", publishCmd.Flags().Lookup("nats_url"))
-
 	// payload is not a viper config value
 	publishCmd.Flags().StringVar(&payload, "payload", "", "message payload")
+	publishCmd.Flags().StringVar(&group, "group", "", "address the message to a group of subscribers instead of the recipient")
 
 }
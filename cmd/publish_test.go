@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+var renderSubjectTestTable = []struct {
+	subject  string
+	payload  interface{}
+	expected string
+	fail     bool
+}{
+	{"eventhandler", nil, "eventhandler", false},
+	{
+		"eventhandler.{{.recipient}}.{{.state}}",
+		map[string]interface{}{"state": "critical"},
+		"eventhandler.me.example.com.critical",
+		false,
+	},
+	// payload keys take precedence over the envelope shortcuts
+	{
+		"eventhandler.{{.recipient}}.{{.envelope.sender}}",
+		map[string]interface{}{"recipient": "web01"},
+		"eventhandler.web01.nagios",
+		false,
+	},
+	{"eventhandler.{{.state}}", map[string]interface{}{}, "", true},
+	{"eventhandler.{{.state}}", map[string]interface{}{"state": "a b"}, "", true},
+}
+
+func TestRenderSubject(t *testing.T) {
+	for _, tt := range renderSubjectTestTable {
+		subject, err := renderSubject(tt.subject, "nagios", "me.example.com", tt.payload)
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: expected failure to be %t, got %v", tt.subject, tt.fail, err)
+		}
+		if subject != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.subject, tt.expected, subject)
+		}
+	}
+}
+
+func TestPublishCmd(t *testing.T) {
+	var (
+		natsUrl, subject string
+		envelope         *model.Envelope
+	)
+	defer func(f func(string, string, *model.Envelope) error) { publishEnvelope = f }(publishEnvelope)
+	publishEnvelope = func(u, s string, msg *model.Envelope) error {
+		natsUrl, subject, envelope = u, s, msg
+		return nil
+	}
+	// the flags override the subject and the nats url of the config file
+	RootCmd.SetArgs([]string{
+		"publish",
+		"--config", "testdata/config_example.yaml",
+		"--signkey", "../verify/testdata/private.key",
+		"--subject", "eventhandler.{{.recipient}}",
+		"--nats_url", "nats://nats.example.com:4222",
+		"--recipient", "web01",
+		"--payload", `{"check_name":"check_http"}`,
+	})
+	defer RootCmd.SetArgs(nil)
+	err := RootCmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if natsUrl != "nats://nats.example.com:4222" || subject != "eventhandler.web01" {
+		t.Errorf("expected to publish on eventhandler.web01 at nats.example.com, got %s at %s", subject, natsUrl)
+	}
+	if envelope == nil || string(envelope.Recipient) != "web01" || len(envelope.Signature) == 0 {
+		t.Errorf("unexpected envelope %v", envelope)
+	}
+}
@@ -1,15 +1,14 @@
 package cmd
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
-	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-
-	"flag"
 	"github.com/prometheus/common/log"
+	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -1,11 +1,12 @@
 package cmd
 
 import (
-	"github.com/spf13/viper"
 	"os"
 	"reflect"
 	"sort"
 	"testing"
+
+	"github.com/spf13/viper"
 )
 
 var (
@@ -1,45 +1,59 @@
 package cmd
 
 import (
-	"errors"
-
-	"bytes"
-	"context"
-	"encoding/json"
-	"github.com/zwopir/eventhandler/filter"
-	"github.com/zwopir/eventhandler/machine"
-	"github.com/zwopir/eventhandler/model"
-	"github.com/zwopir/eventhandler/runner"
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"time"
+
 	"github.com/nats-io/go-nats"
 	"github.com/prometheus/common/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"os"
-	"os/signal"
-	"text/template"
-	"time"
+	"github.com/zwopir/eventhandler/action"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/machine"
 )
 
+// defaultHandlerName is the handler name if the command config doesn't set one
+const defaultHandlerName = "default"
+
 // subscribeCmd represents the subscribe command
 var subscribeCmd = &cobra.Command{
 	Use:   "subscribe",
 	Short: "Subscribe to the eventhandler queue",
 	Long: `Subscribe to the eventhandler queue.
 
-The process listens on the specfied nats topic and runs the specified command if it receives a matching
+The process listens on the specfied nats subjects and runs the specified command if it receives a matching
 message. The message payload is rendered via the configured templated and passed to the commands stdin.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		natsUrl := viper.GetString("nats_url")
-		subject := viper.GetString("subject")
+		// subscribe to the configured list of subjects, or the single subject if there is none
+		subjects := viper.GetStringSlice("subjects")
+		if len(subjects) == 0 {
+			subjects = []string{viper.GetString("subject")}
+		}
+		controlSubject := viper.GetString("control_subject")
 		dialTimeout := 5 * time.Second
 		command := &machine.CoordinatorConfig{}
 		err := viper.UnmarshalKey("command", command)
 		if err != nil {
 			log.Fatal(err)
 		}
-		filterConfig := filter.FilterConfig{}
-		err = viper.UnmarshalKey("filters", &filterConfig)
+		if command.Name == "" {
+			command.Name = defaultHandlerName
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("failed to determine hostname: %s", err)
+		}
+		identity := subscriberIdentity(hostname)
+
+		// create filterer from config. Only envelopes addressed to the identity of the
+		// subscriber, one of its groups or all subscribers are accepted
+		filters, err := newFilters(identity)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -67,74 +81,41 @@ message. The message payload is rendered via the configured templated and passed
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		// parse the configured template
-		stdinTemplate, err := template.New("stdinTemplate").Parse(command.StdinTemplate)
+		err = coordinator.SetMaintenanceWindows(command.Maintenance)
 		if err != nil {
-			log.Fatal("failed to parse stdin template: ", err)
+			log.Fatal(err)
 		}
+		// filter traces are logged at debug level, otherwise only traced on request
+		coordinator.SetTracing(logLevel == "debug")
 
-		// a command only waits `timeout` for a command termination.
-		// Commands running longer than the timeout are kill -9'ed
-		// For further documentation see godoc os/exec CommandContext
-		timeout, err := time.ParseDuration(command.Timeout)
+		// create the action of the configured type
+		act, err := action.New(command.Action, action.Runtime{
+			Conn:     nc,
+			Hostname: identity,
+		})
 		if err != nil {
-			log.Fatal("failed to parse cmd timeout: ", err)
+			log.Fatal(err)
 		}
 
-		// create the runner
-		runner := runner.NewPipeRunner(
-			context.Background(),
-			command.Cmd,
-			command.CmdArgs,
-			timeout,
-			stdinTemplate,
-		)
-
-		// buffer that receives the commands stdout
-		cmdStdout := new(bytes.Buffer)
-
-		// start listening on the configured nats topic
-		err = coordinator.NatsListen(subject)
+		// start listening on the configured nats subjects
+		err = coordinator.NatsListen(subjects...)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		// create filterer from config
-		filters, err := filter.NewFiltererFromConfig(filterConfig)
+		// listen for runtime control messages and requests
+		err = coordinator.NatsControl(machine.ControlConfig{
+			Subject:    controlSubject,
+			Hostname:   identity,
+			Handler:    command.Name,
+			ConfigHash: configHash(),
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		// dispatch messaged received from the queue to the handling function, i.e. the runner
-		coordinator.Dispatch(filters, func(v interface{}) error {
-			var (
-				err         error
-				payloadData interface{}
-			)
-			msg, ok := v.(model.Envelope)
-			if !ok {
-				return errors.New("failed to type assert protobuf message to envelope")
-			}
-			log.Infof("starting runner with message %s \n", msg.CorrelationId)
-
-			// unmarshal the payload
-			err = json.Unmarshal(msg.Payload, &payloadData)
-			if err != nil {
-				return fmt.Errorf("failed to unmarshal payload: %s", err)
-			}
-
-			// run the command with the unmarshaled payload data
-			err = runner.Run(payloadData, cmdStdout)
-			if err != nil {
-				log.Errorf("failed to execute %s: %s", command.Cmd, err)
-				cmdStdout.Reset()
-				return err
-			}
-			log.Debugf("cmd stdout returned %s", cmdStdout.String())
-			cmdStdout.Reset()
-			return nil
-		})
+		// dispatch messaged received from the queue to the action
+		coordinator.Dispatch(filters, act)
 
 		// shutdown coordinator on SIGKILL
 		signalChan := make(chan os.Signal, 1)
@@ -145,12 +126,68 @@ message. The message payload is rendered via the configured templated and passed
 	},
 }
 
+// subscriberIdentity returns the configured identity of the subscriber, or hostname if none is configured.
+// Envelopes and control requests are addressed to the identity
+func subscriberIdentity(hostname string) string {
+	identity := viper.GetString("identity")
+	if identity == "" {
+		return hostname
+	}
+	return identity
+}
+
+// newFilters returns the configured filters with the uses of filter definitions resolved, preceded by the recipient filter of the
+// identity and the groups of the subscriber
+func newFilters(identity string) (filter.Filterer, error) {
+	filterConfig := filter.FilterConfig{}
+	err := viper.UnmarshalKey("filters", &filterConfig)
+	if err != nil {
+		return nil, err
+	}
+	definitions := filter.FilterDefinitions{}
+	err = viper.UnmarshalKey("filter_definitions", &definitions)
+	if err != nil {
+		return nil, err
+	}
+	configFilters, err := filter.NewFiltererWithDefinitions(filterConfig, definitions)
+	if err != nil {
+		return nil, err
+	}
+	groups := viper.GetStringSlice("groups")
+	log.Infof("accepting messages addressed to %s and groups %v", identity, groups)
+	// the recipient filter is part of the battery of the configured filters, so stateful
+	// filters like count only see messages addressed to this subscriber
+	filters := filter.FilterBattery{filter.NewRecipientFilterer(identity, groups)}
+	if battery, ok := configFilters.(filter.FilterBattery); ok {
+		return append(filters, battery...), nil
+	}
+	return append(filters, configFilters), nil
+}
+
+// configHash returns the hex encoded sha256 sum of the used config file
+func configHash() string {
+	content, err := ioutil.ReadFile(viper.ConfigFileUsed())
+	if err != nil {
+		log.Warnf("failed to hash config file: %s", err)
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
+
 func init() {
 	RootCmd.AddCommand(subscribeCmd)
 
 	subscribeCmd.Flags().String("subject", "eventhandler", "nats subject")
+	subscribeCmd.Flags().StringSlice("subjects", []string{}, "nats subjects, may contain wildcards (overrides --subject)")
 	subscribeCmd.Flags().String("nats_url", nats.DefaultURL, "nats url")
+	subscribeCmd.Flags().String("control_subject", machine.DefaultControlSubject, "nats subject for control messages")
+	subscribeCmd.Flags().String("identity", "", "recipient name of the subscriber (default hostname)")
+	subscribeCmd.Flags().StringSlice("groups", []string{}, "groups of the subscriber, addressed as group:<name>")
 
 	viper.BindPFlag("subject", subscribeCmd.Flags().Lookup("subject"))
+	viper.BindPFlag("subjects", subscribeCmd.Flags().Lookup("subjects"))
 	viper.BindPFlag("nats_url", subscribeCmd.Flags().Lookup("nats_url"))
+	viper.BindPFlag("control_subject", subscribeCmd.Flags().Lookup("control_subject"))
+	viper.BindPFlag("identity", subscribeCmd.Flags().Lookup("identity"))
+	viper.BindPFlag("groups", subscribeCmd.Flags().Lookup("groups"))
 }
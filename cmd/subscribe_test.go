@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/model"
+)
+
+func TestSubscriberIdentity(t *testing.T) {
+	defer viper.Set("identity", viper.Get("identity"))
+	viper.Set("identity", "")
+	if identity := subscriberIdentity("host.example.com"); identity != "host.example.com" {
+		t.Errorf("expected the hostname as default identity, got %q", identity)
+	}
+	viper.Set("identity", "me.example.com")
+	if identity := subscriberIdentity("host.example.com"); identity != "me.example.com" {
+		t.Errorf("expected the configured identity, got %q", identity)
+	}
+}
+
+func TestNewFilters(t *testing.T) {
+	for _, key := range []string{"filters", "filter_definitions", "groups"} {
+		defer viper.Set(key, viper.Get(key))
+	}
+	viper.Set("filters", []map[string]interface{}{
+		{"type": "count", "context": "payload map", "args": map[string]string{"field": "host", "threshold": "2", "window": "1m"}},
+	})
+	viper.Set("filter_definitions", nil)
+	viper.Set("groups", nil)
+	// messages addressed to other subscribers must not be counted, neither when matching
+	// nor when tracing the filters
+	for _, evaluate := range []func(filter.Filterer, interface{}) (bool, error){
+		func(f filter.Filterer, v interface{}) (bool, error) { return f.Match(v) },
+		func(f filter.Filterer, v interface{}) (bool, error) {
+			matched, _, err := filter.Explain(f, v)
+			return matched, err
+		},
+	} {
+		filters, err := newFilters("me")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, recipient := range []string{"other", "other", "me", "me"} {
+			msg, err := model.NewMessage(model.Envelope{
+				Recipient: []byte(recipient),
+				Payload:   []byte(`{"host":"web1"}`),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			matched, err := evaluate(filters, msg)
+			if expected := i == 3; err != nil || matched != expected {
+				t.Errorf("message %d to %s: expected %t, got %t (%v)", i, recipient, expected, matched, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/prometheus/common/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zwopir/eventhandler/action"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/machine"
+	"github.com/zwopir/eventhandler/model"
+	"gopkg.in/yaml.v2"
+)
+
+// testCmd represents the test command
+var testCmd = &cobra.Command{
+	Use:   "test [fixture file]",
+	Short: "Evaluate the configured filters and templates with envelopes from a fixture file",
+	Long: `Evaluate the configured filters and templates with envelopes from a fixture file.
+
+The fixture file is a json or yaml list of envelopes, it is read from stdin if no file or "-"
+is given. An envelope has a name, subject, sender, recipient and payload, subject, sender and
+recipient default to the values of the config. The payload is an object or a json string.
+For example
+
+  - name: critical check
+    sender: nagios.example.com
+    payload: {"check_name": "check_connection", "state": "CRITICAL"}
+    expect:
+      fire: true
+      stdin: "check_connection\n"
+      args: ["-"]
+
+For every envelope the command prints if the handler would fire, the filter trace and the
+rendered templates of the action. Nothing is executed and no nats server is needed. The
+optional expectations compare the match and the rendered stdin and args, of the chain step
+expect.step for chain actions. The command exits with status 1 if an expectation isn't met.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var r io.Reader = os.Stdin
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			r = f
+		}
+		fixtures, err := readFixtures(r)
+		if err != nil {
+			log.Fatalf("failed to read fixtures: %s", err)
+		}
+
+		command := &machine.CoordinatorConfig{}
+		err = viper.UnmarshalKey("command", command)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if command.Name == "" {
+			command.Name = defaultHandlerName
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("failed to determine hostname: %s", err)
+		}
+		identity := subscriberIdentity(hostname)
+		filters, err := newFilters(identity)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// without a nats connection the action can only be previewed
+		act, err := action.New(command.Action, action.Runtime{Hostname: identity})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defaults := fixture{
+			Subject:   viper.GetString("subject"),
+			Sender:    viper.GetString("sender"),
+			Recipient: viper.GetString("recipient"),
+		}
+		if !runFixtures(os.Stdout, fixtures, defaults, command.Name, filters, act) {
+			os.Exit(1)
+		}
+	},
+}
+
+// fixture represents an envelope of a fixture file and the expected outcome
+type fixture struct {
+	Name      string             `yaml:"name"`
+	Subject   string             `yaml:"subject"`
+	Sender    string             `yaml:"sender"`
+	Recipient string             `yaml:"recipient"`
+	Payload   interface{}        `yaml:"payload"`
+	Expect    fixtureExpectation `yaml:"expect"`
+}
+
+// fixtureExpectation represents the expected outcome of a fixture. Unset fields aren't checked
+type fixtureExpectation struct {
+	// Fire is the expected filter result
+	Fire *bool `yaml:"fire"`
+	// Step is the chain step Stdin and Args apply to
+	Step  string   `yaml:"step"`
+	Stdin *string  `yaml:"stdin"`
+	Args  []string `yaml:"args"`
+}
+
+// readFixtures reads a json or yaml list of fixtures
+func readFixtures(r io.Reader) ([]fixture, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fixtures := []fixture{}
+	err = yaml.Unmarshal(content, &fixtures)
+	if err != nil {
+		return nil, err
+	}
+	for i := range fixtures {
+		if fixtures[i].Name == "" {
+			fixtures[i].Name = fmt.Sprintf("envelope %d", i)
+		}
+	}
+	return fixtures, nil
+}
+
+// envelope returns the envelope of the fixture. A string payload is used as is,
+// other payloads are encoded as json
+func (f fixture) envelope() (model.Envelope, error) {
+	e := model.Envelope{
+		Sender:    []byte(f.Sender),
+		Recipient: []byte(f.Recipient),
+	}
+	switch payload := f.Payload.(type) {
+	case string:
+		e.Payload = []byte(payload)
+	default:
+		b, err := json.Marshal(jsonValue(payload))
+		if err != nil {
+			return e, fmt.Errorf("failed to encode payload: %s", err)
+		}
+		e.Payload = b
+	}
+	return e, nil
+}
+
+// jsonValue converts the maps decoded from yaml to maps that can be encoded as json
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = jsonValue(value)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// runFixtures evaluates the filters and previews the action of the handler for every
+// fixture and writes the outcome to w. Empty subject, sender and recipient of a fixture
+// are taken from defaults. It returns false if an expectation isn't met or a fixture fails
+func runFixtures(w io.Writer, fixtures []fixture, defaults fixture, handler string, filters filter.Filterer, act action.Action) bool {
+	ok := true
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	for _, f := range fixtures {
+		for _, field := range []struct{ value, fallback *string }{
+			{&f.Subject, &defaults.Subject},
+			{&f.Sender, &defaults.Sender},
+			{&f.Recipient, &defaults.Recipient},
+		} {
+			if *field.value == "" {
+				*field.value = *field.fallback
+			}
+		}
+		fmt.Fprintf(tw, "%s\n", f.Name)
+		failures := runFixture(tw, f, handler, filters, act)
+		for _, failure := range failures {
+			fmt.Fprintf(tw, "  FAIL\t%s\n", failure)
+		}
+		if len(failures) > 0 {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// runFixture writes the outcome of a single fixture to w and returns the unmet expectations
+// and errors
+func runFixture(w io.Writer, f fixture, handler string, filters filter.Filterer, act action.Action) []string {
+	e, err := f.envelope()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	msg, err := model.NewMessage(e)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	msg.Subject = f.Subject
+
+	failures := []string{}
+	matched, trace, err := filter.Explain(filters, msg)
+	renderTrace(w, trace)
+	if err != nil {
+		fmt.Fprintf(w, "  error\t%s\n", err)
+		failures = append(failures, fmt.Sprintf("failed to evaluate filters: %s", err))
+	}
+	fmt.Fprintf(w, "  handler\t%s fires: %t\n", handler, matched)
+	if f.Expect.Fire != nil && *f.Expect.Fire != matched {
+		failures = append(failures, fmt.Sprintf("expected handler %s to fire: %t", handler, *f.Expect.Fire))
+	}
+	if !matched {
+		return failures
+	}
+
+	previewer, ok := act.(action.Previewer)
+	if !ok {
+		fmt.Fprintf(w, "  action\tdoesn't support a preview\n")
+		return failures
+	}
+	preview, err := previewer.Preview(msg)
+	if err != nil {
+		return append(failures, fmt.Sprintf("failed to render action: %s", err))
+	}
+	renderPreview(w, preview, "")
+
+	if f.Expect.Step != "" {
+		var step *action.Preview
+		for _, s := range preview.Steps {
+			if s.Name == f.Expect.Step {
+				step = s
+			}
+		}
+		if step == nil {
+			return append(failures, fmt.Sprintf("action has no step %s", f.Expect.Step))
+		}
+		preview = step
+	}
+	if f.Expect.Stdin == nil && f.Expect.Args == nil {
+		return failures
+	}
+	if preview.Rendering == nil {
+		return append(failures, fmt.Sprintf("%s action renders no stdin and args", preview.Type))
+	}
+	if f.Expect.Stdin != nil && *f.Expect.Stdin != preview.Rendering.Stdin {
+		failures = append(failures, fmt.Sprintf("expected stdin %q, got %q", *f.Expect.Stdin, preview.Rendering.Stdin))
+	}
+	if f.Expect.Args != nil && !reflect.DeepEqual(f.Expect.Args, preview.Rendering.Args) {
+		failures = append(failures, fmt.Sprintf("expected args %q, got %q", f.Expect.Args, preview.Rendering.Args))
+	}
+	return failures
+}
+
+// renderPreview writes the rendered templates of an action to w, chain steps are
+// prefixed with their name
+func renderPreview(w io.Writer, p *action.Preview, prefix string) {
+	if p.Error != "" {
+		fmt.Fprintf(w, "  %serror\t%s\n", prefix, p.Error)
+	}
+	if r := p.Rendering; r != nil {
+		for _, field := range []struct {
+			name  string
+			value string
+		}{
+			{"stdin", fmt.Sprintf("%q", r.Stdin)},
+			{"args", fmt.Sprintf("%q", r.Args)},
+			{"env", fmt.Sprintf("%q", r.Env)},
+			{"dir", r.Dir},
+			{"method", r.Method},
+			{"url", r.URL},
+			{"headers", strings.Join(r.Headers, ", ")},
+			{"body", r.Body},
+		} {
+			if field.value != "" && field.value != `""` && field.value != "[]" {
+				fmt.Fprintf(w, "  %s%s\t%s\n", prefix, field.name, field.value)
+			}
+		}
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"message", p.Message},
+		{"subject", p.Subject},
+		{"sender", p.Sender},
+		{"recipient", p.Recipient},
+		{"payload", p.Payload},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(w, "  %s%s\t%s\n", prefix, field.name, field.value)
+		}
+	}
+	for _, step := range p.Steps {
+		fmt.Fprintf(w, "  %sstep\t%s (%s)\n", prefix, step.Name, step.Type)
+		renderPreview(w, step, prefix+step.Name+".")
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(testCmd)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zwopir/eventhandler/action"
+	"github.com/zwopir/eventhandler/filter"
+)
+
+func TestRunFixtures(t *testing.T) {
+	f, err := os.Open("testdata/fixtures.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fixtures, err := readFixtures(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	act, err := action.New(action.Config{
+		Cmd:           "/bin/sh",
+		CmdArgs:       []string{"-c", "cat"},
+		Timeout:       "5s",
+		StdinTemplate: "{{ .check_name }} {{ .state }}\n",
+	}, action.Runtime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := filter.NewRecipientFilterer("me.example.com", nil)
+	defaults := fixture{Subject: "eventhandler", Sender: "localhost", Recipient: "me.example.com"}
+
+	for _, tt := range []struct {
+		fixtures []fixture
+		ok       bool
+		output   []string
+	}{
+		// the first two fixtures meet their expectations
+		{fixtures[:2], true, []string{"cat fires: true", `"check_connection CRITICAL\n"`, "cat fires: false"}},
+		{fixtures[2:], false, []string{`expected stdin "check_disk CRITICAL\n", got "check_disk WARNING\n"`}},
+	} {
+		b := new(bytes.Buffer)
+		ok := runFixtures(b, tt.fixtures, defaults, "cat", filters, act)
+		if ok != tt.ok {
+			t.Errorf("expected fixtures to pass: %t, got output\n%s", tt.ok, b.String())
+		}
+		for _, s := range tt.output {
+			if !strings.Contains(b.String(), s) {
+				t.Errorf("expected output to contain %q, got\n%s", s, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zwopir/eventhandler/action"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/machine"
+	"github.com/zwopir/eventhandler/templates"
+	"github.com/zwopir/eventhandler/verify"
+	"gopkg.in/yaml.v2"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file without running anything",
+	Long: `Check the config file without running anything.
+
+Every problem is reported with its yaml path: unknown keys, missing settings and filter
+arguments, invalid regular expressions, templates, durations and sizes, unreadable key
+files and filters that can never match together. The command exits with status 1 if the
+config has a problem.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("failed to determine hostname: %s", err)
+		}
+		problems, err := validateConfig(viper.ConfigFileUsed(), hostname)
+		if err != nil {
+			log.Fatalf("failed to read config: %s", err)
+		}
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("%s is valid\n", viper.ConfigFileUsed())
+	},
+}
+
+// configFile represents the keys of a config file
+type configFile struct {
+	Sender            string                    `yaml:"sender"`
+	Recipient         string                    `yaml:"recipient"`
+	SignKey           string                    `yaml:"signkey"`
+	NatsURL           string                    `yaml:"nats_url"`
+	Subject           string                    `yaml:"subject"`
+	Subjects          []string                  `yaml:"subjects"`
+	ControlSubject    string                    `yaml:"control_subject"`
+	Identity          string                    `yaml:"identity"`
+	Groups            []string                  `yaml:"groups"`
+	Command           machine.CoordinatorConfig `yaml:"command"`
+	FilterDefinitions filter.FilterDefinitions  `yaml:"filter_definitions"`
+	Filters           filter.FilterConfig       `yaml:"filters"`
+}
+
+// configProblem represents a problem of the setting at the yaml path
+type configProblem struct {
+	path    string
+	message string
+}
+
+// String formats the problem as "path: message"
+func (p configProblem) String() string {
+	if p.path == "" {
+		return p.message
+	}
+	return fmt.Sprintf("%s: %s", p.path, p.message)
+}
+
+// validateConfig checks the config file and returns all problems. The identity of the
+// subscriber defaults to hostname
+func validateConfig(file, hostname string) ([]configProblem, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	err = yaml.Unmarshal(content, &raw)
+	if err != nil {
+		return nil, err
+	}
+	problems := []configProblem{}
+	cfg := configFile{}
+	err = yaml.Unmarshal(content, &cfg)
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		for _, message := range typeErr.Errors {
+			problems = append(problems, configProblem{message: message})
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	problems = append(problems, unknownKeys("", raw, reflect.TypeOf(cfg))...)
+
+	add := func(path string, err error) {
+		problems = append(problems, configProblem{path: path, message: err.Error()})
+	}
+
+	// publish settings
+	if _, err := templates.New("subject").Parse(cfg.Subject); err != nil {
+		add("subject", err)
+	}
+	for i, subject := range cfg.Subjects {
+		if subject == "" || strings.ContainsAny(subject, " \t") {
+			add(fmt.Sprintf("subjects[%d]", i), fmt.Errorf("%q is not a valid nats subject", subject))
+		}
+	}
+	if cfg.SignKey != "" {
+		if err := readPrivateKey(cfg.SignKey); err != nil {
+			add("signkey", err)
+		}
+	}
+
+	// handler settings
+	for _, e := range action.Validate(cfg.Command.Action) {
+		add(action.JoinPath("command", e.Path), e.Err)
+	}
+	if cfg.Command.Blackout == "" {
+		add("command.blackout", fmt.Errorf("mandatory setting is missing"))
+	} else if _, err := time.ParseDuration(cfg.Command.Blackout); err != nil {
+		add("command.blackout", err)
+	}
+	if cfg.Command.MaxDispatches < 0 {
+		add("command.maxdispatches", fmt.Errorf("must not be negative"))
+	}
+	for i, w := range cfg.Command.Maintenance {
+		if err := w.Validate(); err != nil {
+			add(fmt.Sprintf("command.maintenance[%d]", i), err)
+		}
+	}
+
+	// filters, including the recipient filter of the subscriber
+	if len(cfg.Filters) == 0 {
+		add("filters", fmt.Errorf("no filters are configured"))
+	}
+	for _, err := range filter.ValidateConfig(cfg.Filters, cfg.FilterDefinitions) {
+		add(fmt.Sprintf("filters[%d]", err.FilterIndex()), err)
+	}
+	// definitions are checked even if no filter uses them
+	names := []string{}
+	for name := range cfg.FilterDefinitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, err := range filter.ValidateConfig(cfg.FilterDefinitions[name], cfg.FilterDefinitions) {
+			add(fmt.Sprintf("filter_definitions.%s[%d]", name, err.FilterIndex()), err)
+		}
+	}
+	identity := cfg.Identity
+	if identity == "" {
+		identity = hostname
+	}
+	addresses := []string{identity, filter.RecipientBroadcast}
+	for _, group := range cfg.Groups {
+		addresses = append(addresses, filter.RecipientGroupPrefix+group)
+	}
+	recipient := filter.FilterSettings{
+		Name:    "recipient",
+		Type:    filter.CompareIn,
+		Context: "envelope",
+		Args:    map[string]string{"field": "recipient", "values": strings.Join(addresses, ",")},
+	}
+	resolved, err := cfg.FilterDefinitions.Resolve(cfg.Filters)
+	if err == nil {
+		for _, reason := range filter.Unsatisfiable(append(filter.FilterConfig{recipient}, resolved...)) {
+			problems = append(problems, configProblem{path: "filters", message: "never match: " + reason})
+		}
+	}
+	return problems, nil
+}
+
+// readPrivateKey checks that file is a readable private keyring
+func readPrivateKey(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = verify.NewSigner(f)
+	return err
+}
+
+// unknownKeys returns the keys of the yaml node that don't match a key of type t.
+// Keys are compared case insensitive like viper does
+func unknownKeys(path string, node interface{}, t reflect.Type) []configProblem {
+	problems := []configProblem{}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return unknownKeys(path, node, t.Elem())
+	case reflect.Struct:
+		yamlMap, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return problems
+		}
+		m := stringKeys(yamlMap)
+		fields := yamlFields(t)
+		for _, key := range action.SortedKeys(m) {
+			name := strings.ToLower(key)
+			fieldType, ok := fields[name]
+			if !ok {
+				problems = append(problems, configProblem{path: action.JoinPath(path, key), message: "unknown key"})
+				continue
+			}
+			problems = append(problems, unknownKeys(action.JoinPath(path, key), m[key], fieldType)...)
+		}
+	case reflect.Map:
+		yamlMap, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return problems
+		}
+		m := stringKeys(yamlMap)
+		for _, key := range action.SortedKeys(m) {
+			problems = append(problems, unknownKeys(action.JoinPath(path, key), m[key], t.Elem())...)
+		}
+	case reflect.Slice:
+		l, ok := node.([]interface{})
+		if !ok {
+			return problems
+		}
+		for i, item := range l {
+			problems = append(problems, unknownKeys(fmt.Sprintf("%s[%d]", path, i), item, t.Elem())...)
+		}
+	}
+	return problems
+}
+
+// yamlFields returns the types of the yaml keys of a struct, including the keys of inlined structs
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			for name, fieldType := range yamlFields(f.Type) {
+				fields[name] = fieldType
+			}
+			continue
+		}
+		name := tag[0]
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// stringKeys returns the yaml map with its keys formatted as strings
+func stringKeys(m map[interface{}]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		ret[fmt.Sprint(key)] = value
+	}
+	return ret
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	problems, err := validateConfig("testdata/config_invalid.yaml", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, p := range problems {
+		paths = append(paths, p.path)
+	}
+	expected := []string{
+		"command.retries",
+		"subject",
+		"signkey",
+		"command.timeout",
+		"command.cmdargs[0]",
+		"command.user",
+		"command.output.stdout_limit",
+		"command.blackout",
+		"command.maintenance[0]",
+		"filters[0]",
+		"filters[1]",
+		"filters[2]",
+		"filter_definitions.loop[0]",
+		"filters",
+		"filters",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected problems at\n%q, got\n%q", expected, problems)
+	}
+}
+
+func TestValidateConfig_Example(t *testing.T) {
+	// the key files of the example config are relative to the repository root
+	err := os.Chdir("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir("cmd")
+	problems, err := validateConfig("config_example.yaml", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("expected example config to be valid, got %q", problems)
+	}
+}
@@ -0,0 +1,156 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultCountMaxEntries limits the number of keys a count filter keeps by default
+const defaultCountMaxEntries = 10000
+
+// Stateful is implemented by a Filterer whose result depends on the values it matched
+// before. A FilterBattery evaluates its stateful filters only with values that all other
+// filters match, in the order of the battery
+type Stateful interface {
+	Filterer
+	Stateful()
+}
+
+// isStateful indicates if f is a, possibly named, Stateful filterer
+func isStateful(f Filterer) bool {
+	if nf, ok := f.(namedFilter); ok {
+		f = nf.Filterer
+	}
+	_, ok := f.(Stateful)
+	return ok
+}
+
+// countFilter counts the values by the key retrieved by its retriever and matches once
+// a key occurred threshold times within the sliding window
+type countFilter struct {
+	retriever  Retriever
+	threshold  int
+	window     time.Duration
+	reset      bool
+	maxEntries int
+
+	mu      *sync.Mutex
+	entries map[string][]time.Time
+}
+
+// newCountType is the TypeFactory of the "count" type. The value retrieved by the context is
+// the key, i.e. a "payload template" of host and service. It matches once "threshold"
+// values with the same key are received within "window". If "reset" is true, the count of
+// the key starts over after a match. At most "max_entries" keys are kept, the key that
+// occurred least recently is dropped first
+func newCountType(retriever Retriever, args map[string]string) (Filterer, error) {
+	if retriever == nil {
+		return nil, errors.New("the filter context retrieves no value")
+	}
+	f := countFilter{
+		retriever:  retriever,
+		maxEntries: defaultCountMaxEntries,
+		mu:         &sync.Mutex{},
+		entries:    map[string][]time.Time{},
+	}
+	threshold, err := Argument(args, "threshold")
+	if err != nil {
+		return nil, err
+	}
+	f.threshold, err = strconv.Atoi(threshold)
+	if err != nil || f.threshold < 1 {
+		return nil, &InvalidArgumentError{Argument: "threshold", Err: fmt.Errorf("%q is not a positive number", threshold)}
+	}
+	window, err := Argument(args, "window")
+	if err != nil {
+		return nil, err
+	}
+	f.window, err = time.ParseDuration(window)
+	if err != nil || f.window <= 0 {
+		return nil, &InvalidArgumentError{Argument: "window", Err: fmt.Errorf("%q is not a positive duration", window)}
+	}
+	if reset, ok := args["reset"]; ok {
+		f.reset, err = strconv.ParseBool(reset)
+		if err != nil {
+			return nil, &InvalidArgumentError{Argument: "reset", Err: err}
+		}
+	}
+	if maxEntries, ok := args["max_entries"]; ok {
+		f.maxEntries, err = strconv.Atoi(maxEntries)
+		if err != nil || f.maxEntries < 1 {
+			return nil, &InvalidArgumentError{Argument: "max_entries", Err: fmt.Errorf("%q is not a positive number", maxEntries)}
+		}
+	}
+	return f, nil
+}
+
+// Stateful implements the Stateful interface
+func (f countFilter) Stateful() {}
+
+// Match implements the Filterer interface. The time of a value is the receive time of
+// the message. A missing key doesn't match and isn't counted
+func (f countFilter) Match(v interface{}) (bool, error) {
+	key, err := f.retriever.Value(v)
+	if err == RetrieverMissingFieldError {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	now, _, err := messageTimes(v)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	occurrences, ok := f.entries[string(key)]
+	if !ok && len(f.entries) >= f.maxEntries {
+		f.evict(now)
+	}
+	occurrences = append(f.expire(occurrences, now), now)
+	if len(occurrences) < f.threshold {
+		f.entries[string(key)] = occurrences
+		return false, nil
+	}
+	if f.reset {
+		delete(f.entries, string(key))
+	} else {
+		f.entries[string(key)] = occurrences
+	}
+	return true, nil
+}
+
+// expire returns the occurrences within the window before now
+func (f countFilter) expire(occurrences []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(occurrences) && now.Sub(occurrences[i]) >= f.window {
+		i++
+	}
+	return occurrences[i:]
+}
+
+// evict drops the keys without occurrences within the window before now. If the entry
+// limit is still reached, it drops the key that occurred least recently
+func (f countFilter) evict(now time.Time) {
+	var (
+		oldestKey string
+		oldest    time.Time
+	)
+	for key, occurrences := range f.entries {
+		occurrences = f.expire(occurrences, now)
+		if len(occurrences) == 0 {
+			delete(f.entries, key)
+			continue
+		}
+		f.entries[key] = occurrences
+		if last := occurrences[len(occurrences)-1]; oldest.IsZero() || last.Before(oldest) {
+			oldestKey, oldest = key, last
+		}
+	}
+	if len(f.entries) >= f.maxEntries {
+		delete(f.entries, oldestKey)
+	}
+}
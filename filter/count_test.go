@@ -0,0 +1,145 @@
+package filter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+type countEvent struct {
+	host     string
+	state    string
+	received time.Duration
+	expected bool
+}
+
+// countMessage returns a message of a nagios notification received offset after the test start
+func countMessage(t *testing.T, host, state string, offset time.Duration) *model.Message {
+	msg, err := model.NewMessage(model.Envelope{
+		Payload: []byte(fmt.Sprintf(`{"host":%q,"service":"http","state":%q}`, host, state)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Received = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC).Add(offset)
+	return msg
+}
+
+var countFilterTestTable = []struct {
+	name   string
+	args   map[string]string
+	events []countEvent
+}{
+	{
+		name: "threshold within window",
+		args: map[string]string{"threshold": "3", "window": "10m"},
+		events: []countEvent{
+			{"web1", "CRITICAL", 0, false},
+			{"web1", "CRITICAL", 2 * time.Minute, false},
+			{"web2", "CRITICAL", 3 * time.Minute, false},
+			{"web1", "CRITICAL", 4 * time.Minute, true},
+			// without reset, every further occurrence within the window matches
+			{"web1", "CRITICAL", 5 * time.Minute, true},
+			// the first two occurrences left the window
+			{"web1", "CRITICAL", 12 * time.Minute, true},
+			{"web1", "CRITICAL", 30 * time.Minute, false},
+		},
+	},
+	{
+		name: "reset after match",
+		args: map[string]string{"threshold": "2", "window": "10m", "reset": "true"},
+		events: []countEvent{
+			{"web1", "CRITICAL", 0, false},
+			{"web1", "CRITICAL", time.Minute, true},
+			{"web1", "CRITICAL", 2 * time.Minute, false},
+			{"web1", "CRITICAL", 3 * time.Minute, true},
+		},
+	},
+	{
+		name: "other filters reject",
+		args: map[string]string{"threshold": "2", "window": "10m"},
+		events: []countEvent{
+			{"web1", "CRITICAL", 0, false},
+			{"web1", "OK", time.Minute, false},
+			{"web1", "OK", 2 * time.Minute, false},
+			{"web1", "CRITICAL", 3 * time.Minute, true},
+		},
+	},
+	{
+		name: "entry limit",
+		args: map[string]string{"threshold": "2", "window": "10m", "max_entries": "2"},
+		events: []countEvent{
+			{"web1", "CRITICAL", 0, false},
+			{"web2", "CRITICAL", time.Minute, false},
+			// drops web1, the key that occurred least recently
+			{"web3", "CRITICAL", 2 * time.Minute, false},
+			{"web1", "CRITICAL", 3 * time.Minute, false},
+			{"web1", "CRITICAL", 4 * time.Minute, true},
+		},
+	},
+}
+
+func TestCountType(t *testing.T) {
+	for _, tt := range countFilterTestTable {
+		args := map[string]string{"template": "{{ .host }}/{{ .service }}"}
+		for k, v := range tt.args {
+			args[k] = v
+		}
+		// the count filter comes first, but counts only notifications the state filter matches
+		filters, err := NewFiltererFromConfig(FilterConfig{
+			{Type: "count", Context: "payload template", Args: args},
+			{Type: "eq", Context: "payload map", Args: map[string]string{"field": "state", "value": "CRITICAL"}},
+		})
+		if err != nil {
+			t.Fatalf("%s: failed to create filters: %s", tt.name, err)
+		}
+		for i, event := range tt.events {
+			matched, trace, err := Explain(filters, countMessage(t, event.host, event.state, event.received))
+			if err != nil || matched != event.expected {
+				t.Errorf("%s: event %d: expected %t, got %t (%v)", tt.name, i, event.expected, matched, err)
+			}
+			if skipped := event.state != "CRITICAL"; trace[0].Skipped != skipped {
+				t.Errorf("%s: event %d: expected count filter skipped=%t, got %s", tt.name, i, skipped, trace[0])
+			}
+		}
+	}
+}
+
+func TestCountType_Match(t *testing.T) {
+	filters, err := NewFiltererFromConfig(FilterConfig{
+		{Type: "count", Context: "payload map", Args: map[string]string{"field": "host", "threshold": "2", "window": "1m"}},
+		{Type: "eq", Context: "payload map", Args: map[string]string{"field": "state", "value": "CRITICAL"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, event := range []countEvent{
+		{"web1", "CRITICAL", 0, false},
+		{"web1", "WARNING", time.Second, false},
+		{"web1", "CRITICAL", 2 * time.Second, true},
+	} {
+		matched, err := filters.Match(countMessage(t, event.host, event.state, event.received))
+		if err != nil || matched != event.expected {
+			t.Errorf("event %d: expected %t, got %t (%v)", i, event.expected, matched, err)
+		}
+	}
+}
+
+func TestCountType_Args(t *testing.T) {
+	for _, args := range []map[string]string{
+		{"window": "10m"},
+		{"threshold": "3"},
+		{"threshold": "0", "window": "10m"},
+		{"threshold": "3", "window": "-1m"},
+		{"threshold": "3", "window": "10m", "reset": "maybe"},
+		{"threshold": "3", "window": "10m", "max_entries": "none"},
+	} {
+		args["field"] = "host"
+		_, err := NewFiltererFromConfig(FilterConfig{{Type: "count", Context: "payload map", Args: args}})
+		if _, ok := err.(ConfigError); !ok {
+			t.Errorf("%v: expected a config error, got %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterDefinitions represents named filter groups. A filter that sets Use is replaced by
+// the filters of the definition with that name. Definitions can use other definitions,
+// names are case insensitive
+type FilterDefinitions map[string]FilterConfig
+
+// UnknownDefinitionError is returned for a filter that uses a definition that doesn't exist
+type UnknownDefinitionError struct {
+	Index int
+	Name  string
+}
+
+// Error implements the error interface
+func (e *UnknownDefinitionError) Error() string {
+	return fmt.Sprintf("filter %d: filter definition %q doesn't exist", e.Index, e.Name)
+}
+
+// FilterIndex implements the ConfigError interface
+func (e *UnknownDefinitionError) FilterIndex() int {
+	return e.Index
+}
+
+// DefinitionCycleError is returned for filter definitions that use each other
+type DefinitionCycleError struct {
+	Index int
+	// Cycle is the chain of definition names, the first and last names are the same
+	Cycle []string
+}
+
+// Error implements the error interface
+func (e *DefinitionCycleError) Error() string {
+	return fmt.Sprintf("filter %d: filter definitions use each other: %s", e.Index, strings.Join(e.Cycle, " -> "))
+}
+
+// FilterIndex implements the ConfigError interface
+func (e *DefinitionCycleError) FilterIndex() int {
+	return e.Index
+}
+
+// lookup returns the definition of name
+func (d FilterDefinitions) lookup(name string) (FilterConfig, bool) {
+	if cfg, ok := d[name]; ok {
+		return cfg, true
+	}
+	for key, cfg := range d {
+		if strings.EqualFold(key, name) {
+			return cfg, true
+		}
+	}
+	return nil, false
+}
+
+// Resolve returns the config with all uses of definitions replaced by the filters of the
+// definitions. Resolved filters are named after the definition, i.e. "trusted_nagios/signature".
+// Errors implement ConfigError, their index is the index of the filter in configFilters
+func (d FilterDefinitions) Resolve(configFilters FilterConfig) (FilterConfig, error) {
+	resolved := FilterConfig{}
+	for i, cf := range configFilters {
+		filters, err := d.resolve(i, cf, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, filters...)
+	}
+	return resolved, nil
+}
+
+// resolve returns the filters of cf at index i. The names of the filters are prefixed
+// with prefix, used are the names of the definitions that lead to cf
+func (d FilterDefinitions) resolve(i int, cf FilterSettings, prefix string, used []string) (FilterConfig, error) {
+	if cf.Use == "" {
+		cf.Name = prefix + filterName(cf)
+		return FilterConfig{cf}, nil
+	}
+	if cf.Type != "" || cf.Context != "" {
+		return nil, &InvalidArgumentError{Index: i, Err: fmt.Errorf("filter using definition %q must not set type or context", cf.Use)}
+	}
+	for j, name := range used {
+		if strings.EqualFold(name, cf.Use) {
+			cycle := append(append([]string{}, used[j:]...), cf.Use)
+			return nil, &DefinitionCycleError{Index: i, Cycle: cycle}
+		}
+	}
+	definition, ok := d.lookup(cf.Use)
+	if !ok {
+		return nil, &UnknownDefinitionError{Index: i, Name: cf.Use}
+	}
+	name := cf.Use
+	if cf.Name != "" {
+		name = cf.Name
+	}
+	used = append(append([]string{}, used...), cf.Use)
+	resolved := FilterConfig{}
+	for _, definitionFilter := range definition {
+		filters, err := d.resolve(i, definitionFilter, prefix+name+"/", used)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, filters...)
+	}
+	return resolved, nil
+}
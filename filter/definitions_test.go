@@ -0,0 +1,70 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+var testDefinitions = FilterDefinitions{
+	"nagios": {
+		{Type: "regexp", Context: "envelope", Args: map[string]string{"field": "sender", "regexp": "^nagios"}},
+	},
+	"critical_nagios": {
+		{Use: "nagios"},
+		{Type: "eq", Context: "payload map", Args: map[string]string{"field": "state", "value": "CRITICAL"}},
+	},
+	"loop_a": {{Use: "loop_b"}},
+	"loop_b": {{Use: "loop_a"}},
+}
+
+func TestFilterDefinitions_Resolve(t *testing.T) {
+	filters, err := NewFiltererWithDefinitions(FilterConfig{
+		{Type: "exists", Context: "payload map", Args: map[string]string{"field": "check_name"}},
+		{Use: "critical_nagios"},
+	}, testDefinitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := model.NewMessage(model.Envelope{
+		Sender:  []byte("nagios.example.com"),
+		Payload: []byte(`{"check_name":"check_foo","state":"CRITICAL"}`),
+	})
+	matched, trace, err := Explain(filters, msg)
+	if err != nil || !matched {
+		t.Errorf("expected message to match, got %t (%v)", matched, err)
+	}
+	names := []string{}
+	for _, entry := range trace {
+		names = append(names, entry.Name)
+	}
+	expected := []string{
+		"exists payload map check_name",
+		"critical_nagios/nagios/regexp envelope sender",
+		"critical_nagios/eq payload map state",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected trace names %q, got %q", expected, names)
+	}
+}
+
+func TestFilterDefinitions_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		config   FilterConfig
+		expected ConfigError
+	}{
+		{FilterConfig{{Use: "critical_nagios"}, {Use: "loop_a"}}, &DefinitionCycleError{Index: 1, Cycle: []string{"loop_a", "loop_b", "loop_a"}}},
+		{FilterConfig{{Use: "unknown"}}, &UnknownDefinitionError{Index: 0, Name: "unknown"}},
+		{FilterConfig{{Use: "nagios", Type: "regexp"}}, nil},
+	} {
+		_, err := testDefinitions.Resolve(tt.config)
+		if err == nil {
+			t.Errorf("%v: expected resolving to fail", tt.config)
+			continue
+		}
+		if tt.expected != nil && !reflect.DeepEqual(err, tt.expected) {
+			t.Errorf("%v: expected %v, got %v", tt.config, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package filter
+
+import (
+	"fmt"
+)
+
+// ConfigError is implemented by the errors of NewFiltererFromConfig
+type ConfigError interface {
+	error
+	// FilterIndex returns the index of the invalid filter in the FilterConfig
+	FilterIndex() int
+}
+
+// UnknownContextError is returned for a filter context that isn't registered
+type UnknownContextError struct {
+	Index   int
+	Context string
+}
+
+// Error implements the error interface
+func (e *UnknownContextError) Error() string {
+	return fmt.Sprintf("filter %d: filter context %q is not implemented", e.Index, e.Context)
+}
+
+// FilterIndex implements the ConfigError interface
+func (e *UnknownContextError) FilterIndex() int {
+	return e.Index
+}
+
+// UnknownTypeError is returned for a filter type that isn't registered
+type UnknownTypeError struct {
+	Index int
+	Type  string
+}
+
+// Error implements the error interface
+func (e *UnknownTypeError) Error() string {
+	return fmt.Sprintf("filter %d: filter type %q is not implemented", e.Index, e.Type)
+}
+
+// FilterIndex implements the ConfigError interface
+func (e *UnknownTypeError) FilterIndex() int {
+	return e.Index
+}
+
+// MissingArgumentError is returned for a mandatory filter argument that isn't set.
+// Factories return it with the argument name, the index is set by NewFiltererFromConfig
+type MissingArgumentError struct {
+	Index    int
+	Argument string
+}
+
+// Error implements the error interface
+func (e *MissingArgumentError) Error() string {
+	return fmt.Sprintf("filter %d: mandatory argument %q not found", e.Index, e.Argument)
+}
+
+// FilterIndex implements the ConfigError interface
+func (e *MissingArgumentError) FilterIndex() int {
+	return e.Index
+}
+
+// InvalidArgumentError is returned for a filter argument that can't be used, i.e. a regexp
+// that doesn't compile. Factories return it with the argument name, the index is set by
+// NewFiltererFromConfig. Other errors of factories are returned as InvalidArgumentError
+// without argument name
+type InvalidArgumentError struct {
+	Index    int
+	Argument string
+	Err      error
+}
+
+// Error implements the error interface
+func (e *InvalidArgumentError) Error() string {
+	if e.Argument == "" {
+		return fmt.Sprintf("filter %d: %s", e.Index, e.Err)
+	}
+	return fmt.Sprintf("filter %d: invalid argument %q: %s", e.Index, e.Argument, e.Err)
+}
+
+// FilterIndex implements the ConfigError interface
+func (e *InvalidArgumentError) FilterIndex() int {
+	return e.Index
+}
+
+// Unwrap returns the cause of the error
+func (e *InvalidArgumentError) Unwrap() error {
+	return e.Err
+}
+
+// withIndex sets the filter index of a factory error
+func withIndex(err error, index int) error {
+	switch e := err.(type) {
+	case *MissingArgumentError:
+		e.Index = index
+	case *InvalidArgumentError:
+		e.Index = index
+	case *UnknownContextError:
+		e.Index = index
+	case *UnknownTypeError:
+		e.Index = index
+	default:
+		return &InvalidArgumentError{Index: index, Err: err}
+	}
+	return err
+}
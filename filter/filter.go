@@ -2,15 +2,17 @@ package filter
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
-	"github.com/zwopir/eventhandler/model"
-	"github.com/zwopir/eventhandler/verify"
 	"fmt"
-	"github.com/prometheus/common/log"
+	"math/big"
 	"os"
 	"regexp"
+	"strings"
 	"text/template"
+
+	"github.com/zwopir/eventhandler/model"
+	"github.com/zwopir/eventhandler/templates"
+	"github.com/zwopir/eventhandler/verify"
 )
 
 var (
@@ -23,6 +25,10 @@ type FilterConfig []FilterSettings
 // Filter represents the filter settings, the Args keys and values are specific to the filtering
 // implemented in the package "model"
 type FilterSettings struct {
+	// Name identifies the filter in traces. If empty, it is derived from the settings
+	Name string `yaml:"name"`
+	// Use references a filter definition that replaces the filter, see FilterDefinitions
+	Use     string            `yaml:"use"`
 	Type    string            `yaml:"type"`
 	Context string            `yaml:"context"`
 	Args    map[string]string `yaml:"args"`
@@ -46,18 +52,30 @@ func newFilterBattery(filters ...Filterer) FilterBattery {
 }
 
 // Match implements the Filterer interface. It returns a match if all contained Filterer slice elements
-// return a match
+// return a match. Stateful filters are evaluated after all other filters matched
 func (f FilterBattery) Match(v interface{}) (bool, error) {
-	for _, f := range f {
-		matched, err := f.Match(v)
-		if err != nil {
-			return false, err
-		}
-		if !matched {
-			return false, nil
+	i, err := f.rejecting(v)
+	return i < 0, err
+}
+
+// rejecting returns the index of the first filter that doesn't match v or fails, or -1 if
+// all filters match. Stateful filters are evaluated after all other filters matched
+func (f FilterBattery) rejecting(v interface{}) (int, error) {
+	for _, stateful := range []bool{false, true} {
+		for i, f := range f {
+			if isStateful(f) != stateful {
+				continue
+			}
+			matched, err := f.Match(v)
+			if err != nil {
+				return i, err
+			}
+			if !matched {
+				return i, nil
+			}
 		}
 	}
-	return true, nil
+	return -1, nil
 }
 
 // basicFilter is an unexported basic type that implements the Filterer interface
@@ -78,9 +96,9 @@ func newBasicFilter(f func(interface{}) (bool, error)) basicFilter {
 	}
 }
 
-// retriever retrieves a value to be filtered by a Filterer
-type retriever interface {
-	getValue(v interface{}) ([]byte, error)
+// Retriever retrieves a value to be filtered by a Filterer
+type Retriever interface {
+	Value(v interface{}) ([]byte, error)
 }
 
 // envelopeValueRetriever retrieves a value from an envelope struct field
@@ -88,11 +106,50 @@ type envelopeValueRetriever struct {
 	field string
 }
 
-// getValue implements the retriever interface
-func (r envelopeValueRetriever) getValue(v interface{}) ([]byte, error) {
-	e, ok := v.(model.Envelope)
-	if !ok {
-		return nil, fmt.Errorf("type assertion of %v to Envelope failed", v)
+// envelopeOf returns the envelope and the subject of v, a received *model.Message or a bare
+// model.Envelope without subject
+func envelopeOf(v interface{}) (model.Envelope, string, error) {
+	switch m := v.(type) {
+	case *model.Message:
+		return m.Envelope, m.Subject, nil
+	case model.Envelope:
+		return m, "", nil
+	default:
+		return model.Envelope{}, "", fmt.Errorf("type assertion of %v to Envelope failed", v)
+	}
+}
+
+// payloadOf returns the decoded payload of v. The payload of a *model.Message is decoded
+// once on receive, the payload of a bare model.Envelope is decoded on every call
+func payloadOf(v interface{}) (interface{}, error) {
+	if m, ok := v.(*model.Message); ok {
+		return m.Payload, nil
+	}
+	e, _, err := envelopeOf(v)
+	if err != nil {
+		return nil, err
+	}
+	return model.DecodePayload(e.Payload)
+}
+
+// exactPayloadOf returns the decoded payload of v like payloadOf, but with numbers as
+// json.Number, so that retrieved numbers compare exactly
+func exactPayloadOf(v interface{}) (interface{}, error) {
+	if m, ok := v.(*model.Message); ok {
+		return m.ExactPayload, nil
+	}
+	e, _, err := envelopeOf(v)
+	if err != nil {
+		return nil, err
+	}
+	return model.DecodeExactPayload(e.Payload)
+}
+
+// Value implements the Retriever interface
+func (r envelopeValueRetriever) Value(v interface{}) ([]byte, error) {
+	e, subject, err := envelopeOf(v)
+	if err != nil {
+		return nil, err
 	}
 	switch r.field {
 	case "sender":
@@ -103,6 +160,8 @@ func (r envelopeValueRetriever) getValue(v interface{}) ([]byte, error) {
 		return e.Payload, nil
 	case "signature":
 		return e.Signature, nil
+	case "subject":
+		return []byte(subject), nil
 	default:
 		return nil, RetrieverMissingFieldError
 	}
@@ -116,7 +175,7 @@ func newEnvelopeValueRetriever(field string) envelopeValueRetriever {
 }
 
 // payloadMapRetriever retrieves a value from the envelope's payload.
-// It is assumed that the payload is marshalable to a map[string]string
+// It is assumed that the payload is a json object
 type payloadMapRetriever struct {
 	key string
 }
@@ -126,21 +185,21 @@ func newPayloadMapRetriever(key string) payloadMapRetriever {
 	return payloadMapRetriever{key: key}
 }
 
-// getValue implements the retriever interface
-func (p payloadMapRetriever) getValue(v interface{}) ([]byte, error) {
-	e, ok := v.(model.Envelope)
-	if !ok {
-		return nil, fmt.Errorf("type assertion of %v to Envelope failed", v)
-	}
-	message := map[string]string{}
-	err := json.Unmarshal(e.Payload, &message)
+// Value implements the Retriever interface
+func (p payloadMapRetriever) Value(v interface{}) ([]byte, error) {
+	data, err := exactPayloadOf(v)
 	if err != nil {
 		return nil, err
 	}
-	if ret, ok := message[p.key]; ok {
-		return []byte(ret), nil
+	message, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("payload %v is not a json object", data)
+	}
+	ret, ok := message[p.key]
+	if !ok {
+		return nil, RetrieverMissingFieldError
 	}
-	return nil, RetrieverMissingFieldError
+	return stringify(ret)
 }
 
 // payloadTemplateRetriever retrieves a value from the envelope's payload via template.
@@ -150,7 +209,7 @@ type payloadTemplateRetriever struct {
 }
 
 func newPayloadTemplateRetriever(tmplString string) (payloadTemplateRetriever, error) {
-	tmpl, err := template.New("PayloadTemplate").Parse(tmplString)
+	tmpl, err := templates.New("PayloadTemplate").Parse(tmplString)
 	if err != nil {
 		return payloadTemplateRetriever{}, err
 	}
@@ -159,18 +218,13 @@ func newPayloadTemplateRetriever(tmplString string) (payloadTemplateRetriever, e
 	}, nil
 }
 
-// getValue implements the retriever interface
-func (tr payloadTemplateRetriever) getValue(v interface{}) ([]byte, error) {
-	var data interface{}
-	e, ok := v.(model.Envelope)
-	if !ok {
-		return nil, fmt.Errorf("type assertion of %v to Envelope failed", v)
-	}
-	b := new(bytes.Buffer)
-	err := json.Unmarshal(e.Payload, &data)
+// Value implements the Retriever interface
+func (tr payloadTemplateRetriever) Value(v interface{}) ([]byte, error) {
+	data, err := payloadOf(v)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve data: %s", err)
 	}
+	b := new(bytes.Buffer)
 	err = tr.template.Execute(b, data)
 	if err != nil {
 		return nil, err
@@ -178,24 +232,126 @@ func (tr payloadTemplateRetriever) getValue(v interface{}) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// recipient addresses besides the identity of a subscriber
+const (
+	// RecipientBroadcast addresses all subscribers
+	RecipientBroadcast = "*"
+	// RecipientGroupPrefix prefixes the name of a group, i.e. "group:webservers"
+	RecipientGroupPrefix = "group:"
+)
+
+// NewRecipientFilterer returns a filterer that matches envelopes addressed to identity,
+// to one of the groups or to all subscribers
+func NewRecipientFilterer(identity string, groups []string) Filterer {
+	addresses := map[string]bool{
+		identity:           true,
+		RecipientBroadcast: true,
+	}
+	for _, group := range groups {
+		addresses[RecipientGroupPrefix+group] = true
+	}
+	return namedFilter{
+		name: "recipient",
+		Filterer: valueFilter{
+			retriever: newEnvelopeValueRetriever("recipient"),
+			predicate: func(value []byte) bool { return addresses[string(value)] },
+		},
+	}
+}
+
 // newRegexpFilterer returns a filterer that implements the filterer interface.
 // It retrieves the value with the provided retriever and matches it against the provided regexp
-func newRegexpFilterer(retriever retriever, regexp *regexp.Regexp) Filterer {
-	filterer := newBasicFilter(
-		func(v interface{}) (bool, error) {
-			valueToCompare, err := retriever.getValue(v)
-			// consider match tries on a non existent field as a non-match
-			if err == RetrieverMissingFieldError {
-				return false, nil
-			}
-			// a real error occurred
-			if err != nil {
-				return false, err
+func newRegexpFilterer(retriever Retriever, regexp *regexp.Regexp) (Filterer, error) {
+	return NewValueFilterer(retriever, regexp.Match)
+}
+
+// comparison filter types
+const (
+	CompareEq     = "eq"
+	CompareNe     = "ne"
+	CompareLt     = "lt"
+	CompareLe     = "le"
+	CompareGt     = "gt"
+	CompareGe     = "ge"
+	CompareIn     = "in"
+	CompareExists = "exists"
+)
+
+// numberPrecision is the precision in bits numbers are compared with. It represents
+// integers of more than 150 digits exactly
+const numberPrecision = 512
+
+// compareValues compares a and b numerically if both parse as numbers and lexically otherwise.
+// It returns -1, 0 or 1 if a is less than, equal to or greater than b
+func compareValues(a, b string) int {
+	af, aOk := parseNumber(a)
+	bf, bOk := parseNumber(b)
+	if !aOk || !bOk {
+		return strings.Compare(a, b)
+	}
+	return af.Cmp(bf)
+}
+
+// parseNumber parses s as number with the precision values are compared with
+func parseNumber(s string) (*big.Float, bool) {
+	f, _, err := big.ParseFloat(strings.TrimSpace(s), 10, numberPrecision, big.ToNearestEven)
+	return f, err == nil
+}
+
+// newCompareFilterer returns a filterer that compares the retrieved value with the values
+// via the comparison filter type op. Only "in" uses more than the first value.
+// A missing field doesn't match
+func newCompareFilterer(retriever Retriever, op string, values []string) (Filterer, error) {
+	cmp, err := comparePredicate(op, values)
+	if err != nil {
+		return nil, err
+	}
+	return NewValueFilterer(retriever, func(value []byte) bool { return cmp(string(value)) })
+}
+
+// splitValues splits the comma separated values of an in filter
+func splitValues(values string) []string {
+	list := []string{}
+	for _, value := range strings.Split(values, ",") {
+		list = append(list, strings.TrimSpace(value))
+	}
+	return list
+}
+
+// comparePredicate returns the predicate of the comparison filter type op with the values
+func comparePredicate(op string, values []string) (func(value string) bool, error) {
+	var cmp func(value string) bool
+	switch op {
+	case CompareEq:
+		cmp = func(value string) bool { return compareValues(value, values[0]) == 0 }
+	case CompareNe:
+		cmp = func(value string) bool { return compareValues(value, values[0]) != 0 }
+	case CompareLt:
+		cmp = func(value string) bool { return compareValues(value, values[0]) < 0 }
+	case CompareLe:
+		cmp = func(value string) bool { return compareValues(value, values[0]) <= 0 }
+	case CompareGt:
+		cmp = func(value string) bool { return compareValues(value, values[0]) > 0 }
+	case CompareGe:
+		cmp = func(value string) bool { return compareValues(value, values[0]) >= 0 }
+	case CompareIn:
+		cmp = func(value string) bool {
+			for _, v := range values {
+				if compareValues(value, v) == 0 {
+					return true
+				}
 			}
-			return regexp.Match(valueToCompare), nil
-		},
-	)
-	return filterer
+			return false
+		}
+	case CompareExists:
+		cmp = func(string) bool { return true }
+	default:
+		return nil, fmt.Errorf("unknown comparison %q", op)
+	}
+	if op != CompareExists && len(values) == 0 {
+		return nil, fmt.Errorf("comparison %q requires a value", op)
+	}
+	return cmp, nil
 }
 
 func newSignatureFilterer(verifier *verify.Verifier) Filterer {
@@ -203,13 +359,13 @@ func newSignatureFilterer(verifier *verify.Verifier) Filterer {
 		func(v interface{}) (bool, error) {
 			messageBuffer := new(bytes.Buffer)
 			for _, envelopeField := range []string{"sender", "recipient", "payload"} {
-				value, err := envelopeValueRetriever{field: envelopeField}.getValue(v)
+				value, err := envelopeValueRetriever{field: envelopeField}.Value(v)
 				if err != nil {
 					return false, err
 				}
 				messageBuffer.Write(value)
 			}
-			signature, err := envelopeValueRetriever{field: "signature"}.getValue(v)
+			signature, err := envelopeValueRetriever{field: "signature"}.Value(v)
 			if err != nil {
 				return false, err
 			}
@@ -224,75 +380,193 @@ func newSignatureFilterer(verifier *verify.Verifier) Filterer {
 }
 
 // NewFiltererFromConfig returns a filterBattery, implementing the Filterer interface.
-// The basic filterer and retriever are chosen based on the provided filter config
+// The Retriever and the Filterer are created by the factories registered for the
+// context and the type of each filter. Errors implement ConfigError
 func NewFiltererFromConfig(configFilters FilterConfig) (Filterer, error) {
-	var (
-		retriever retriever
-		matcher   Filterer
-		err       error
-		re        *regexp.Regexp
-	)
+	return NewFiltererWithDefinitions(configFilters, nil)
+}
+
+// NewFiltererWithDefinitions returns a filterBattery like NewFiltererFromConfig. Filters
+// that use a definition are replaced by the filters of the definition
+func NewFiltererWithDefinitions(configFilters FilterConfig, definitions FilterDefinitions) (Filterer, error) {
 	filters := []Filterer{}
-	for _, cf := range configFilters {
-		switch cf.Context {
-		case "payload map":
-			field, found := cf.Args["field"]
-			if !found {
-				return nil, errors.New("mandatory argument 'field' not found in payload filter configuration.")
-			}
-			retriever = newPayloadMapRetriever(field)
-		case "payload template":
-			tmplString, found := cf.Args["template"]
-			if !found {
-				return nil, errors.New("mandatory agument 'template' not found in template filter configuration")
-			}
-			retriever, err = newPayloadTemplateRetriever(tmplString)
-			if err != nil {
-				return nil, fmt.Errorf("failed to initialize template value retreiver: %s", err)
-			}
-		case "envelope":
-			field, found := cf.Args["field"]
-			if !found {
-				return nil, errors.New("mandatory argument 'field' not found in filter configuration.")
-			}
-			retriever = newEnvelopeValueRetriever(field)
-		case "signature":
-			// pass
-		default:
-			log.Fatalf("filter context %q is not implemented", cf.Context)
+	for i, cf := range configFilters {
+		resolved, err := definitions.resolve(i, cf, "", nil)
+		if err != nil {
+			return nil, err
 		}
-		switch cf.Type {
-		case "regexp":
-			regexpString, found := cf.Args["regexp"]
-			if !found {
-				return nil, errors.New("mandatory argument 'regexp' not found in filter configuration")
-			}
-			re, err = regexp.Compile(regexpString)
+		for _, rcf := range resolved {
+			f, err := newFilter(i, rcf)
 			if err != nil {
 				return nil, err
 			}
-			matcher = newRegexpFilterer(retriever, re)
-		case "signature":
-			verifyKey, found := cf.Args["verifykey"]
-			if !found {
-				return nil, errors.New("mandatory argument 'verifykey' not found in filter configuration")
+			filters = append(filters, f)
+		}
+	}
+	if len(filters) < 1 {
+		return nil, errors.New("filter battery contains no filter")
+	}
+	return newFilterBattery(filters...), nil
+}
+
+// ValidateConfig creates all filters of the config and returns the errors of all invalid filters
+func ValidateConfig(configFilters FilterConfig, definitions FilterDefinitions) []ConfigError {
+	errs := []ConfigError{}
+	for i, cf := range configFilters {
+		resolved, err := definitions.resolve(i, cf, "", nil)
+		if err != nil {
+			errs = append(errs, err.(ConfigError))
+			continue
+		}
+		for _, rcf := range resolved {
+			_, err := newFilter(i, rcf)
+			if err != nil {
+				errs = append(errs, err.(ConfigError))
 			}
-			verifyKeyBuffer, err := os.Open(verifyKey)
+		}
+	}
+	return errs
+}
+
+// newFilter creates the named filter at index i of a FilterConfig
+func newFilter(i int, cf FilterSettings) (Filterer, error) {
+	contextFactory, typeFactory := lookup(cf.Context, cf.Type)
+	if contextFactory == nil {
+		return nil, &UnknownContextError{Index: i, Context: cf.Context}
+	}
+	if typeFactory == nil {
+		return nil, &UnknownTypeError{Index: i, Type: cf.Type}
+	}
+	retriever, err := contextFactory(cf.Args)
+	if err != nil {
+		return nil, withIndex(err, i)
+	}
+	matcher, err := typeFactory(retriever, cf.Args)
+	if err != nil {
+		return nil, withIndex(err, i)
+	}
+	return namedFilter{name: filterName(cf), Filterer: matcher}, nil
+}
+
+// newPayloadMapContext is the ContextFactory of the "payload map" context
+func newPayloadMapContext(args map[string]string) (Retriever, error) {
+	field, err := Argument(args, "field")
+	if err != nil {
+		return nil, err
+	}
+	return newPayloadMapRetriever(field), nil
+}
+
+// newPayloadTemplateContext is the ContextFactory of the "payload template" context
+func newPayloadTemplateContext(args map[string]string) (Retriever, error) {
+	tmplString, err := Argument(args, "template")
+	if err != nil {
+		return nil, err
+	}
+	retriever, err := newPayloadTemplateRetriever(tmplString)
+	if err != nil {
+		return nil, &InvalidArgumentError{Argument: "template", Err: err}
+	}
+	return retriever, nil
+}
+
+// newPayloadPathContext is the ContextFactory of the "payload path" context
+func newPayloadPathContext(args map[string]string) (Retriever, error) {
+	path, err := Argument(args, "path")
+	if err != nil {
+		return nil, err
+	}
+	retriever, err := newPayloadPathRetriever(path)
+	if err != nil {
+		return nil, &InvalidArgumentError{Argument: "path", Err: err}
+	}
+	return retriever, nil
+}
+
+// newEnvelopeContext is the ContextFactory of the "envelope" context
+func newEnvelopeContext(args map[string]string) (Retriever, error) {
+	field, err := Argument(args, "field")
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelopeValueRetriever(field), nil
+}
+
+// newSignatureContext is the ContextFactory of the "signature" context, it retrieves no value
+func newSignatureContext(args map[string]string) (Retriever, error) {
+	return nil, nil
+}
+
+// newRegexpType is the TypeFactory of the "regexp" type
+func newRegexpType(retriever Retriever, args map[string]string) (Filterer, error) {
+	regexpString, err := Argument(args, "regexp")
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(regexpString)
+	if err != nil {
+		return nil, &InvalidArgumentError{Argument: "regexp", Err: err}
+	}
+	return newRegexpFilterer(retriever, re)
+}
+
+// newCompareType returns the TypeFactory of the comparison type op
+func newCompareType(op string) TypeFactory {
+	return func(retriever Retriever, args map[string]string) (Filterer, error) {
+		var values []string
+		switch op {
+		case CompareExists:
+		case CompareIn:
+			list, err := Argument(args, "values")
 			if err != nil {
 				return nil, err
 			}
-			verifier, err := verify.NewVerifier(verifyKeyBuffer)
+			values = splitValues(list)
+		default:
+			value, err := Argument(args, "value")
 			if err != nil {
 				return nil, err
 			}
-			matcher = newSignatureFilterer(verifier)
-		default:
-			log.Fatalf("filter type %q is not implemented", cf.Type)
+			values = []string{value}
 		}
-		filters = append(filters, matcher)
+		return newCompareFilterer(retriever, op, values)
 	}
-	if len(filters) < 1 {
-		return nil, errors.New("filter battery contains no filter")
+}
+
+// newSignatureType is the TypeFactory of the "signature" type
+func newSignatureType(retriever Retriever, args map[string]string) (Filterer, error) {
+	verifyKey, err := Argument(args, "verifykey")
+	if err != nil {
+		return nil, err
 	}
-	return newFilterBattery(filters...), nil
+	verifyKeyBuffer, err := os.Open(verifyKey)
+	if err != nil {
+		return nil, &InvalidArgumentError{Argument: "verifykey", Err: err}
+	}
+	defer verifyKeyBuffer.Close()
+	verifier, err := verify.NewVerifier(verifyKeyBuffer)
+	if err != nil {
+		return nil, &InvalidArgumentError{Argument: "verifykey", Err: err}
+	}
+	return newSignatureFilterer(verifier), nil
+}
+
+func init() {
+	RegisterContext("payload map", newPayloadMapContext)
+	RegisterContext("payload template", newPayloadTemplateContext)
+	RegisterContext("payload path", newPayloadPathContext)
+	RegisterContext("envelope", newEnvelopeContext)
+	RegisterContext("signature", newSignatureContext)
+	RegisterContext("time", newTimeContext)
+	RegisterType("regexp", newRegexpType)
+	for _, op := range []string{CompareEq, CompareNe, CompareLt, CompareLe, CompareGt, CompareGe, CompareIn, CompareExists} {
+		RegisterType(op, newCompareType(op))
+	}
+	RegisterType("glob", newGlobType)
+	RegisterType("prefix", newPrefixType)
+	RegisterType("suffix", newSuffixType)
+	RegisterType("cidr", newCIDRType)
+	RegisterType("timerange", newTimeRangeType)
+	RegisterType("count", newCountType)
+	RegisterType("signature", newSignatureType)
 }
@@ -1,8 +1,10 @@
 package filter
 
 import (
-	"github.com/zwopir/eventhandler/model"
+	"reflect"
 	"testing"
+
+	"github.com/zwopir/eventhandler/model"
 )
 
 var (
@@ -87,6 +89,25 @@ var (
 				},
 			},
 		},
+		{
+			model.Envelope{
+				Sender:    []byte(`a_sender`),
+				Recipient: []byte(`a_recipient`),
+				Payload:   []byte(`{"check_name":"CHECK_FOO"}`),
+				Signature: []byte(`sig sig sig`),
+			},
+			true,
+			FilterConfig{
+				{
+					Context: "payload template",
+					Type:    "regexp",
+					Args: map[string]string{
+						"template": "{{ .check_name | lower }}",
+						"regexp":   "^check_.+",
+					},
+				},
+			},
+		},
 	}
 )
 
@@ -128,3 +149,243 @@ func TestNewFilters(t *testing.T) {
 		)
 	}
 }
+
+var missingKeyFilter = FilterConfig{
+	{
+		Context: "payload template",
+		Type:    "regexp",
+		Args: map[string]string{
+			"template": "{{ .missing }}",
+			"regexp":   ".*",
+		},
+	},
+}
+
+func TestFilters_Match2(t *testing.T) {
+	filters, err := NewFiltererFromConfig(missingKeyFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = filters.Match(model.Envelope{Payload: []byte(`{"check_name":"check_foo"}`)})
+	if err == nil {
+		t.Error("rendering a missing key should fail")
+	}
+}
+
+var subjectFilter = FilterConfig{
+	{
+		Context: "envelope",
+		Type:    "regexp",
+		Args: map[string]string{
+			"field":  "subject",
+			"regexp": `^eventhandler\.[^.]+\.critical$`,
+		},
+	},
+}
+
+func TestFilters_Match3(t *testing.T) {
+	filters, err := NewFiltererFromConfig(subjectFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for subject, expected := range map[string]bool{
+		"eventhandler.web01.critical": true,
+		"eventhandler.web01.warning":  false,
+	} {
+		msg, err := model.NewMessage(model.Envelope{Payload: []byte(`{"check_name":"check_foo"}`)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Subject = subject
+		matched, err := filters.Match(msg)
+		if err != nil {
+			t.Errorf("Match failed with: %s", err)
+		}
+		if matched != expected {
+			t.Errorf("expected subject %s to match: %t", subject, expected)
+		}
+	}
+}
+
+func TestNewRecipientFilterer(t *testing.T) {
+	filters := NewRecipientFilterer("web01", []string{"webservers", "berlin"})
+	for recipient, expected := range map[string]bool{
+		"web01":            true,
+		"*":                true,
+		"group:webservers": true,
+		"group:berlin":     true,
+		"web02":            false,
+		"group:databases":  false,
+		"webservers":       false,
+	} {
+		matched, err := filters.Match(model.Envelope{Recipient: []byte(recipient)})
+		if err != nil {
+			t.Errorf("Match failed with: %s", err)
+		}
+		if matched != expected {
+			t.Errorf("expected recipient %s to match: %t", recipient, expected)
+		}
+	}
+}
+
+var compareFilterTestTable = []struct {
+	filterType string
+	context    string
+	args       map[string]string
+	expected   bool
+}{
+	{"eq", "payload map", map[string]string{"field": "attempt", "value": "3"}, true},
+	{"eq", "payload map", map[string]string{"field": "attempt", "value": "3.0"}, true},
+	{"ne", "payload map", map[string]string{"field": "attempt", "value": "3"}, false},
+	{"ge", "payload map", map[string]string{"field": "attempt", "value": "3"}, true},
+	{"gt", "payload map", map[string]string{"field": "attempt", "value": "3"}, false},
+	// numeric, not lexical comparison
+	{"lt", "payload map", map[string]string{"field": "attempt", "value": "10"}, true},
+	{"le", "payload map", map[string]string{"field": "state", "value": "CRITICAL"}, true},
+	{"in", "payload map", map[string]string{"field": "state", "values": "WARNING, CRITICAL"}, true},
+	{"in", "payload map", map[string]string{"field": "state", "values": "OK,UNKNOWN"}, false},
+	{"exists", "payload map", map[string]string{"field": "state"}, true},
+	{"exists", "payload map", map[string]string{"field": "missing"}, false},
+	{"gt", "payload map", map[string]string{"field": "missing", "value": "1"}, false},
+	{"gt", "payload template", map[string]string{"template": "{{ .perfdata.load }}", "value": "5.0"}, true},
+	{"eq", "envelope", map[string]string{"field": "sender", "value": "a_sender"}, true},
+	{"exists", "envelope", map[string]string{"field": "nofield"}, false},
+	// integers beyond the precision of a float64
+	{"eq", "payload map", map[string]string{"field": "id", "value": "9007199254740993"}, true},
+	{"eq", "payload map", map[string]string{"field": "id", "value": "9007199254740992"}, false},
+	{"gt", "payload path", map[string]string{"path": "$.id", "value": "9007199254740992"}, true},
+	{"in", "payload map", map[string]string{"field": "id", "values": "9007199254740992,9007199254740994"}, false},
+}
+
+func TestCompareFilterer(t *testing.T) {
+	message := model.Envelope{
+		Sender:  []byte(`a_sender`),
+		Payload: []byte(`{"attempt":3,"state":"CRITICAL","perfdata":{"load":5.5},"id":9007199254740993}`),
+	}
+	for _, tt := range compareFilterTestTable {
+		filters, err := NewFiltererFromConfig(FilterConfig{{Type: tt.filterType, Context: tt.context, Args: tt.args}})
+		if err != nil {
+			t.Fatalf("failed to create %s filter: %s", tt.filterType, err)
+		}
+		matched, err := filters.Match(message)
+		if err != nil {
+			t.Errorf("Match failed with: %s", err)
+		}
+		if matched != tt.expected {
+			t.Errorf("expected %s filter with %v to match: %t", tt.filterType, tt.args, tt.expected)
+		}
+	}
+}
+
+func TestNewCompareFilterer(t *testing.T) {
+	for _, cf := range []FilterSettings{
+		{Type: "gt", Context: "payload map", Args: map[string]string{"field": "attempt"}},
+		{Type: "in", Context: "payload map", Args: map[string]string{"field": "attempt"}},
+	} {
+		_, err := NewFiltererFromConfig(FilterConfig{cf})
+		if err == nil {
+			t.Errorf("expected %s filter without value to fail", cf.Type)
+		}
+	}
+}
+
+// benchmarkFilterConfig returns a configuration of 20 matching payload filters
+func benchmarkFilterConfig() FilterConfig {
+	config := FilterConfig{}
+	for i := 0; i < 5; i++ {
+		config = append(config,
+			FilterSettings{Type: "regexp", Context: "payload map", Args: map[string]string{"field": "check_name", "regexp": "check_.+"}},
+			FilterSettings{Type: "ge", Context: "payload map", Args: map[string]string{"field": "attempt", "value": "3"}},
+			FilterSettings{Type: "regexp", Context: "payload template", Args: map[string]string{"template": "{{ .state }}", "regexp": "CRITICAL"}},
+			FilterSettings{Type: "eq", Context: "payload path", Args: map[string]string{"path": "$.service.tags[0]", "value": "web"}},
+		)
+	}
+	return config
+}
+
+var benchmarkEnvelope = model.Envelope{
+	Sender:    []byte(`a_sender`),
+	Recipient: []byte(`a_recipient`),
+	Payload:   []byte(`{"check_name":"check_foo","attempt":3,"state":"CRITICAL","service":{"name":"http","tags":["web"]}}`),
+}
+
+// BenchmarkFilterBattery_MatchEnvelope decodes the payload in every filter
+func BenchmarkFilterBattery_MatchEnvelope(b *testing.B) {
+	filters, err := NewFiltererFromConfig(benchmarkFilterConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matched, err := filters.Match(benchmarkEnvelope)
+		if err != nil || !matched {
+			b.Fatalf("expected a match, got %t (%v)", matched, err)
+		}
+	}
+}
+
+// BenchmarkFilterBattery_MatchMessage decodes the payload once per message
+func BenchmarkFilterBattery_MatchMessage(b *testing.B) {
+	filters, err := NewFiltererFromConfig(benchmarkFilterConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg, err := model.NewMessage(benchmarkEnvelope)
+		if err != nil {
+			b.Fatal(err)
+		}
+		matched, err := filters.Match(msg)
+		if err != nil || !matched {
+			b.Fatalf("expected a match, got %t (%v)", matched, err)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	filters, err := NewFiltererFromConfig(FilterConfig{
+		{Type: "regexp", Context: "payload map", Args: map[string]string{"field": "check_name", "regexp": "check_.+"}},
+		{Name: "enough attempts", Type: "ge", Context: "payload map", Args: map[string]string{"field": "attempt", "value": "3"}},
+		{Type: "exists", Context: "payload path", Args: map[string]string{"path": "$.perfdata"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	battery := FilterBattery{NewRecipientFilterer("me", nil), filters}
+	matched, trace, err := Explain(battery, model.Envelope{
+		Recipient: []byte("me"),
+		Payload:   []byte(`{"check_name":"check_foo","attempt":2}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Trace{
+		{Name: "recipient", Value: "me", Matched: true},
+		{Name: "regexp payload map check_name", Value: "check_foo", Matched: true},
+		{Name: "enough attempts", Value: "2", Matched: false},
+		{Name: "exists payload path $.perfdata", Missing: true, Matched: false},
+	}
+	if matched || !reflect.DeepEqual(trace, expected) {
+		t.Errorf("expected no match with trace %v, got %t with %v", expected, matched, trace)
+	}
+}
+
+func TestRejection(t *testing.T) {
+	filters, err := NewFiltererFromConfig(FilterConfig{
+		{Name: "enough attempts", Type: "ge", Context: "payload map", Args: map[string]string{"field": "attempt", "value": "3"}},
+		{Type: "regexp", Context: "payload template", Args: map[string]string{"template": "{{ .missing.key }}", "regexp": "x"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like Match, the failing template isn't evaluated after the first mismatch
+	matched, name, err := Rejection(filters, model.Envelope{Payload: []byte(`{"attempt":2}`)})
+	if matched || name != "enough attempts" || err != nil {
+		t.Errorf("expected a rejection by enough attempts, got %t, %q (%v)", matched, name, err)
+	}
+	matched, name, err = Rejection(filters, model.Envelope{Payload: []byte(`{"attempt":3}`)})
+	if matched || name != "regexp payload template {{ .missing.key }}" || err == nil {
+		t.Errorf("expected the template filter to fail, got %t, %q (%v)", matched, name, err)
+	}
+}
@@ -0,0 +1,170 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// constraint is a filter on a single value
+type constraint struct {
+	name      string
+	op        string
+	value     string
+	predicate func(value string) bool
+	// candidates are the only values the filter matches, nil if it matches an open set
+	candidates []string
+}
+
+// valueKey describes the value a filter retrieves. It is empty for filters whose
+// values aren't compared
+func valueKey(cf FilterSettings) string {
+	switch cf.Context {
+	case "envelope":
+		return "envelope field " + cf.Args["field"]
+	case "payload map":
+		return "payload field " + cf.Args["field"]
+	case "payload path":
+		return "payload path " + cf.Args["path"]
+	}
+	return ""
+}
+
+// newConstraint returns the constraint of a regexp or comparison filter, ok is false
+// for other and invalid filters
+func newConstraint(cf FilterSettings) (constraint, bool) {
+	c := constraint{name: filterName(cf), op: cf.Type, value: cf.Args["value"]}
+	switch cf.Type {
+	case "regexp":
+		re, err := regexp.Compile(cf.Args["regexp"])
+		if err != nil {
+			return c, false
+		}
+		// comparisons match numbers by value, the payload may write them differently,
+		// i.e. 3.0 for 3. A regexp can't rule out a number
+		c.predicate = func(value string) bool {
+			_, isNumber := parseNumber(value)
+			return isNumber || re.MatchString(value)
+		}
+		return c, true
+	case CompareEq:
+		c.candidates = []string{c.value}
+	case CompareIn:
+		c.candidates = splitValues(cf.Args["values"])
+	case CompareNe, CompareLt, CompareLe, CompareGt, CompareGe:
+	default:
+		return c, false
+	}
+	values := c.candidates
+	if values == nil {
+		values = []string{c.value}
+	}
+	var err error
+	c.predicate, err = comparePredicate(cf.Type, values)
+	return c, err == nil
+}
+
+// Unsatisfiable returns the reasons why no message can pass all filters of the config.
+// Regexp and comparison filters on the same envelope field, payload field or payload
+// path are checked against each other. Invalid filters are ignored
+func Unsatisfiable(configFilters FilterConfig) []string {
+	keys := []string{}
+	groups := map[string][]constraint{}
+	for _, cf := range configFilters {
+		key := valueKey(cf)
+		if key == "" {
+			continue
+		}
+		c, ok := newConstraint(cf)
+		if !ok {
+			continue
+		}
+		if _, found := groups[key]; !found {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], c)
+	}
+	reasons := []string{}
+	for _, key := range keys {
+		constraints := groups[key]
+		if len(constraints) < 2 || satisfiable(constraints) {
+			continue
+		}
+		names := []string{}
+		for _, c := range constraints {
+			names = append(names, strconv.Quote(c.name))
+		}
+		reasons = append(reasons, fmt.Sprintf("filters %s can't match the same %s", strings.Join(names, ", "), key))
+	}
+	return reasons
+}
+
+// satisfiable indicates if a value can meet all constraints. If a constraint restricts
+// the value to a set, the set is tested. Otherwise only numeric bounds are checked
+func satisfiable(constraints []constraint) bool {
+	candidates := []string{}
+	restricted := false
+	for _, c := range constraints {
+		if c.candidates != nil {
+			restricted = true
+			candidates = append(candidates, c.candidates...)
+		}
+	}
+	if restricted {
+		for _, candidate := range candidates {
+			if meetsAll(candidate, constraints) {
+				return true
+			}
+		}
+		return false
+	}
+	return boundsOverlap(constraints)
+}
+
+// meetsAll indicates if the value meets all constraints
+func meetsAll(value string, constraints []constraint) bool {
+	for _, c := range constraints {
+		if !c.predicate(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// boundsOverlap indicates if the numeric lower and upper bounds of the constraints
+// leave a value. Bounds are compared like the values of comparison filters
+func boundsOverlap(constraints []constraint) bool {
+	var (
+		lower, upper             string
+		hasLower, hasUpper       bool
+		lowerStrict, upperStrict bool
+	)
+	for _, c := range constraints {
+		if _, ok := parseNumber(c.value); !ok {
+			continue
+		}
+		switch c.op {
+		case CompareGt, CompareGe:
+			strict := c.op == CompareGt
+			cmp := compareValues(c.value, lower)
+			if !hasLower || cmp > 0 || (cmp == 0 && strict) {
+				lower, lowerStrict, hasLower = c.value, strict, true
+			}
+		case CompareLt, CompareLe:
+			strict := c.op == CompareLt
+			cmp := compareValues(c.value, upper)
+			if !hasUpper || cmp < 0 || (cmp == 0 && strict) {
+				upper, upperStrict, hasUpper = c.value, strict, true
+			}
+		}
+	}
+	if !hasLower || !hasUpper {
+		return true
+	}
+	cmp := compareValues(lower, upper)
+	if cmp == 0 {
+		return !lowerStrict && !upperStrict
+	}
+	return cmp < 0
+}
@@ -0,0 +1,45 @@
+package filter
+
+import (
+	"testing"
+)
+
+func compareSettings(typ, field, arg, value string) FilterSettings {
+	return FilterSettings{
+		Type:    typ,
+		Context: "payload map",
+		Args:    map[string]string{"field": field, arg: value},
+	}
+}
+
+var unsatisfiableTestTable = []struct {
+	config  FilterConfig
+	reasons int
+}{
+	{FilterConfig{compareSettings("eq", "state", "value", "CRITICAL")}, 0},
+	// different fields don't restrict each other
+	{FilterConfig{compareSettings("eq", "state", "value", "OK"), compareSettings("eq", "check", "value", "CRITICAL")}, 0},
+	{FilterConfig{compareSettings("eq", "state", "value", "OK"), compareSettings("eq", "state", "value", "CRITICAL")}, 1},
+	{FilterConfig{compareSettings("in", "state", "values", "OK, CRITICAL"), compareSettings("regexp", "state", "regexp", "^CRIT")}, 0},
+	{FilterConfig{compareSettings("in", "state", "values", "OK,WARNING"), compareSettings("ne", "state", "value", "OK"), compareSettings("regexp", "state", "regexp", "^CRIT")}, 1},
+	{FilterConfig{compareSettings("eq", "attempt", "value", "3.0"), compareSettings("ge", "attempt", "value", "3")}, 0},
+	{FilterConfig{compareSettings("gt", "attempt", "value", "3"), compareSettings("le", "attempt", "value", "5")}, 0},
+	{FilterConfig{compareSettings("gt", "attempt", "value", "3"), compareSettings("lt", "attempt", "value", "3")}, 1},
+	{FilterConfig{compareSettings("ge", "attempt", "value", "3"), compareSettings("le", "attempt", "value", "3")}, 0},
+	// numbers are compared by value, a regexp may match the written form of the payload
+	{FilterConfig{compareSettings("eq", "attempt", "value", "3"), compareSettings("regexp", "attempt", "regexp", `^3\.0$`)}, 0},
+	{FilterConfig{compareSettings("gt", "id", "value", "9007199254740992"), compareSettings("lt", "id", "value", "9007199254740993.5")}, 0},
+	{FilterConfig{compareSettings("gt", "id", "value", "9007199254740993"), compareSettings("lt", "id", "value", "9007199254740993.5")}, 0},
+	{FilterConfig{compareSettings("ge", "id", "value", "9007199254740993"), compareSettings("le", "id", "value", "9007199254740992")}, 1},
+	// invalid filters are ignored
+	{FilterConfig{compareSettings("eq", "state", "value", "OK"), compareSettings("regexp", "state", "regexp", "(")}, 0},
+}
+
+func TestUnsatisfiable(t *testing.T) {
+	for i, tt := range unsatisfiableTestTable {
+		reasons := Unsatisfiable(tt.config)
+		if len(reasons) != tt.reasons {
+			t.Errorf("%d: expected %d reasons, got %q", i, tt.reasons, reasons)
+		}
+	}
+}
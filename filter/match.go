@@ -0,0 +1,153 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// defaultGlobSeparator separates the path segments matched by "*" in glob patterns
+const defaultGlobSeparator = "/"
+
+// globToRegexp translates a shell-style glob pattern into an anchored regular expression.
+// "*" matches any sequence without separator, "**" any sequence, "?" a single character
+// other than separator and "[...]" a character class. Like in shells with globstar, "**"
+// followed by the separator also matches zero segments, so "a/**/b" matches "a/b"
+func globToRegexp(pattern, separator string) (*regexp.Regexp, error) {
+	notSeparator := "[^" + regexp.QuoteMeta(separator) + "]"
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			switch {
+			case strings.HasPrefix(pattern[i:], "**"+separator):
+				b.WriteString("(?:.*" + regexp.QuoteMeta(separator) + ")?")
+				i += 1 + len(separator)
+			case strings.HasPrefix(pattern[i:], "**"):
+				b.WriteString(".*")
+				i++
+			default:
+				b.WriteString(notSeparator + "*")
+			}
+		case '?':
+			b.WriteString(notSeparator)
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in %q", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// newGlobType is the TypeFactory of the "glob" type. The optional argument "separator"
+// sets the separator of the path segments, i.e. "." for nats subjects
+func newGlobType(retriever Retriever, args map[string]string) (Filterer, error) {
+	pattern, err := Argument(args, "pattern")
+	if err != nil {
+		return nil, err
+	}
+	separator, ok := args["separator"]
+	if !ok {
+		separator = defaultGlobSeparator
+	}
+	if len(separator) != 1 {
+		return nil, &InvalidArgumentError{Argument: "separator", Err: fmt.Errorf("separator %q is not a single character", separator)}
+	}
+	re, err := globToRegexp(pattern, separator)
+	if err != nil {
+		return nil, &InvalidArgumentError{Argument: "pattern", Err: err}
+	}
+	return NewValueFilterer(retriever, re.Match)
+}
+
+// newPrefixType is the TypeFactory of the "prefix" type
+func newPrefixType(retriever Retriever, args map[string]string) (Filterer, error) {
+	prefix, err := Argument(args, "prefix")
+	if err != nil {
+		return nil, err
+	}
+	return NewValueFilterer(retriever, func(value []byte) bool {
+		return bytes.HasPrefix(value, []byte(prefix))
+	})
+}
+
+// newSuffixType is the TypeFactory of the "suffix" type
+func newSuffixType(retriever Retriever, args map[string]string) (Filterer, error) {
+	suffix, err := Argument(args, "suffix")
+	if err != nil {
+		return nil, err
+	}
+	return NewValueFilterer(retriever, func(value []byte) bool {
+		return bytes.HasSuffix(value, []byte(suffix))
+	})
+}
+
+// parseNetworks parses a comma separated list of networks in CIDR notation. A single
+// address is a network of one address
+func parseNetworks(list string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, s := range splitValues(list) {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is neither a network nor an address", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// newCIDRType is the TypeFactory of the "cidr" type. It matches values that parse as
+// IP address and are part of one of the comma separated "networks"
+func newCIDRType(retriever Retriever, args map[string]string) (Filterer, error) {
+	list, err := Argument(args, "networks")
+	if err != nil {
+		return nil, err
+	}
+	networks, err := parseNetworks(list)
+	if err != nil {
+		return nil, &InvalidArgumentError{Argument: "networks", Err: err}
+	}
+	return NewValueFilterer(retriever, func(value []byte) bool {
+		ip := net.ParseIP(strings.TrimSpace(string(value)))
+		if ip == nil {
+			return false
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	})
+}
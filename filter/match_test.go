@@ -0,0 +1,73 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+var matchTypeTestTable = []struct {
+	filterType string
+	args       map[string]string
+	value      string
+	expected   bool
+}{
+	{"glob", map[string]string{"pattern": "web*.example.com"}, "web01.example.com", true},
+	{"glob", map[string]string{"pattern": "/var/*/app.log"}, "/var/log/app.log", true},
+	{"glob", map[string]string{"pattern": "/var/*/app.log"}, "/var/log/nested/app.log", false},
+	{"glob", map[string]string{"pattern": "/var/**/app.log"}, "/var/log/nested/app.log", true},
+	{"glob", map[string]string{"pattern": "/var/**/app.log"}, "/var/app.log", true},
+	{"glob", map[string]string{"pattern": "/var/**/app.log"}, "/var/myapp.log", false},
+	{"glob", map[string]string{"pattern": "**/app.log"}, "app.log", true},
+	{"glob", map[string]string{"pattern": "checks.**.disk", "separator": "."}, "checks.disk", true},
+	{"glob", map[string]string{"pattern": "web0?.*", "separator": "."}, "web01.example", true},
+	{"glob", map[string]string{"pattern": "web0?.*", "separator": "."}, "web01.example.com", false},
+	{"glob", map[string]string{"pattern": "web[!0-4]"}, "web7", true},
+	{"glob", map[string]string{"pattern": "web[!0-4]"}, "web3", false},
+	{"glob", map[string]string{"pattern": `check\*`}, "check*", true},
+	{"glob", map[string]string{"pattern": `check\*`}, "check_foo", false},
+	{"prefix", map[string]string{"prefix": "check_"}, "check_disk", true},
+	{"prefix", map[string]string{"prefix": "check_"}, "disk_check", false},
+	{"suffix", map[string]string{"suffix": ".example.com"}, "web01.example.com", true},
+	{"suffix", map[string]string{"suffix": ".example.com"}, "web01.example.org", false},
+	{"cidr", map[string]string{"networks": "10.0.0.0/8, 192.168.1.0/24"}, "192.168.1.17", true},
+	{"cidr", map[string]string{"networks": "10.0.0.0/8, 192.168.1.0/24"}, "192.168.2.17", false},
+	{"cidr", map[string]string{"networks": "2001:db8::/32"}, "2001:db8::1", true},
+	{"cidr", map[string]string{"networks": "10.0.0.1"}, "10.0.0.1", true},
+	{"cidr", map[string]string{"networks": "10.0.0.0/8"}, "web01", false},
+}
+
+func TestMatchTypes(t *testing.T) {
+	for _, tt := range matchTypeTestTable {
+		args := map[string]string{"field": "value"}
+		for k, v := range tt.args {
+			args[k] = v
+		}
+		filters, err := NewFiltererFromConfig(FilterConfig{{Type: tt.filterType, Context: "payload map", Args: args}})
+		if err != nil {
+			t.Fatalf("failed to create %s filter: %s", tt.filterType, err)
+		}
+		msg, err := model.NewMessage(model.Envelope{Payload: []byte(`{"value":"` + tt.value + `"}`)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched, err := filters.Match(msg)
+		if err != nil || matched != tt.expected {
+			t.Errorf("%s %v with %q: expected %t, got %t (%v)", tt.filterType, tt.args, tt.value, tt.expected, matched, err)
+		}
+	}
+}
+
+func TestMatchTypes_InvalidArguments(t *testing.T) {
+	for _, cf := range []FilterSettings{
+		{Type: "glob", Context: "envelope", Args: map[string]string{"field": "sender", "pattern": "web[0-9"}},
+		{Type: "glob", Context: "envelope", Args: map[string]string{"field": "sender", "pattern": "*", "separator": "::"}},
+		{Type: "cidr", Context: "envelope", Args: map[string]string{"field": "sender", "networks": "10.0.0.0/33"}},
+		{Type: "cidr", Context: "envelope", Args: map[string]string{"field": "sender", "networks": "web01"}},
+	} {
+		_, err := NewFiltererFromConfig(FilterConfig{cf})
+		if _, ok := err.(*InvalidArgumentError); !ok {
+			t.Errorf("%v: expected an invalid argument, got %v", cf.Args, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is a single step of a payload path, either an object key or an array index
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath parses a JSONPath like ($.service.tags[0]) or dotted (service.tags.0) path
+// into its segments. Keys containing dots or brackets can be quoted as ['a.b']
+func parsePath(path string) ([]pathSegment, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	segments := []pathSegment{}
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in path %q", path)
+			}
+			inner := p[1:end]
+			p = p[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid array index %q in path %q", inner, path)
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			segments = append(segments, pathSegment{key: p[:end]})
+			p = p[end:]
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("empty path %q", path)
+	}
+	return segments, nil
+}
+
+// lookupPath returns the value at the path segments in the decoded json data.
+// Dotted numeric keys index arrays as well
+func lookupPath(data interface{}, segments []pathSegment) (interface{}, bool) {
+	current := data
+	for _, s := range segments {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			if s.isIndex {
+				return nil, false
+			}
+			v, ok := c[s.key]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case []interface{}:
+			index := s.index
+			if !s.isIndex {
+				var err error
+				index, err = strconv.Atoi(s.key)
+				if err != nil {
+					return nil, false
+				}
+			}
+			if index < 0 || index >= len(c) {
+				return nil, false
+			}
+			current = c[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// stringify formats a decoded json value for matching. Strings are returned as is, numbers
+// as written in the payload, booleans as true or false, null as null and objects and arrays json encoded
+func stringify(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case string:
+		return []byte(value), nil
+	case json.Number:
+		return []byte(value.String()), nil
+	case float64:
+		return []byte(strconv.FormatFloat(value, 'f', -1, 64)), nil
+	case bool:
+		return []byte(strconv.FormatBool(value)), nil
+	case nil:
+		return []byte("null"), nil
+	default:
+		return json.Marshal(value)
+	}
+}
+
+// payloadPathRetriever retrieves a value from the envelope's json payload by path
+type payloadPathRetriever struct {
+	segments []pathSegment
+}
+
+// newPayloadPathRetriever returns a new payloadPathRetriever
+func newPayloadPathRetriever(path string) (payloadPathRetriever, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return payloadPathRetriever{}, err
+	}
+	return payloadPathRetriever{segments: segments}, nil
+}
+
+// Value implements the Retriever interface
+func (p payloadPathRetriever) Value(v interface{}) ([]byte, error) {
+	data, err := exactPayloadOf(v)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := lookupPath(data, p.segments)
+	if !ok {
+		return nil, RetrieverMissingFieldError
+	}
+	return stringify(value)
+}
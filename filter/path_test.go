@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+var payloadPathTestTable = []struct {
+	path     string
+	expected string
+	missing  bool
+}{
+	{"$.service.name", "http", false},
+	{"$.service.tags[0]", "web", false},
+	{"service.tags.1", "frontend", false},
+	{"$['service']['name']", "http", false},
+	{"$.attempt", "3", false},
+	{"$.perfdata.load", "5.5", false},
+	{"$.perfdata.bytes", "12345678901", false},
+	{"$.id", "9007199254740993", false},
+	{"$.acknowledged", "false", false},
+	{"$.comment", "null", false},
+	{"$.service.tags", `["web","frontend"]`, false},
+	{"$.service.tags[2]", "", true},
+	{"$.service.missing", "", true},
+	{"$.attempt.value", "", true},
+}
+
+func TestPayloadPathRetriever_Value(t *testing.T) {
+	message := model.Envelope{
+		Payload: []byte(`{
+			"service": {"name": "http", "tags": ["web", "frontend"]},
+			"attempt": 3,
+			"perfdata": {"load": 5.5, "bytes": 12345678901},
+			"id": 9007199254740993,
+			"acknowledged": false,
+			"comment": null
+		}`),
+	}
+	for _, tt := range payloadPathTestTable {
+		r, err := newPayloadPathRetriever(tt.path)
+		if err != nil {
+			t.Fatalf("failed to parse path %s: %s", tt.path, err)
+		}
+		value, err := r.Value(message)
+		if tt.missing {
+			if err != RetrieverMissingFieldError {
+				t.Errorf("expected %s to be missing, got %q (%v)", tt.path, value, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to retrieve %s: %s", tt.path, err)
+		}
+		if string(value) != tt.expected {
+			t.Errorf("expected %s to be %q, got %q", tt.path, tt.expected, value)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	for _, path := range []string{"", "$", "$.tags[", "$.tags[a]", "$.tags[-1]"} {
+		_, err := parsePath(path)
+		if err == nil {
+			t.Errorf("parsing %q should fail", path)
+		}
+	}
+}
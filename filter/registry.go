@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ContextFactory creates the Retriever of a filter context from the filter arguments.
+// Contexts that don't retrieve a value, like "signature", return a nil Retriever
+type ContextFactory func(args map[string]string) (Retriever, error)
+
+// TypeFactory creates the Filterer of a filter type from the Retriever of the filter
+// context and the filter arguments
+type TypeFactory func(retriever Retriever, args map[string]string) (Filterer, error)
+
+var (
+	registryMu sync.RWMutex
+	contexts   = map[string]ContextFactory{}
+	types      = map[string]TypeFactory{}
+)
+
+// RegisterContext makes a filter context available under the name. It panics if the
+// name is registered twice
+func RegisterContext(name string, f ContextFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := contexts[name]; ok {
+		panic(fmt.Sprintf("filter context %q is already registered", name))
+	}
+	contexts[name] = f
+}
+
+// RegisterType makes a filter type available under the name. It panics if the
+// name is registered twice
+func RegisterType(name string, f TypeFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := types[name]; ok {
+		panic(fmt.Sprintf("filter type %q is already registered", name))
+	}
+	types[name] = f
+}
+
+// Contexts returns the sorted names of the registered filter contexts
+func Contexts() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ret := []string{}
+	for name := range contexts {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Types returns the sorted names of the registered filter types
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ret := []string{}
+	for name := range types {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// lookup returns the factories of the filter context and type
+func lookup(context, typ string) (ContextFactory, TypeFactory) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return contexts[context], types[typ]
+}
+
+// Argument returns the mandatory argument name of args, or a MissingArgumentError
+func Argument(args map[string]string, name string) (string, error) {
+	value, ok := args[name]
+	if !ok {
+		return "", &MissingArgumentError{Argument: name}
+	}
+	return value, nil
+}
+
+// NewValueFilterer returns a Filterer that matches the value retrieved by retriever with
+// predicate. A missing value doesn't match, the retrieved value is shown in traces
+func NewValueFilterer(retriever Retriever, predicate func(value []byte) bool) (Filterer, error) {
+	if retriever == nil {
+		return nil, errors.New("the filter context retrieves no value")
+	}
+	return valueFilter{
+		retriever: retriever,
+		predicate: predicate,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+var configErrorTestTable = []struct {
+	config   FilterConfig
+	index    int
+	expected error
+}{
+	{
+		FilterConfig{
+			{Type: "regexp", Context: "envelope", Args: map[string]string{"field": "sender", "regexp": ".*"}},
+			{Type: "regexp", Context: "payload", Args: map[string]string{"field": "check_name", "regexp": ".*"}},
+		},
+		1,
+		&UnknownContextError{},
+	},
+	{
+		FilterConfig{{Type: "match", Context: "envelope", Args: map[string]string{"field": "sender"}}},
+		0,
+		&UnknownTypeError{},
+	},
+	{
+		FilterConfig{{Type: "regexp", Context: "payload map", Args: map[string]string{"regexp": ".*"}}},
+		0,
+		&MissingArgumentError{},
+	},
+	{
+		FilterConfig{
+			{Type: "exists", Context: "payload map", Args: map[string]string{"field": "state"}},
+			{Type: "exists", Context: "payload map", Args: map[string]string{"field": "attempt"}},
+			{Type: "regexp", Context: "payload map", Args: map[string]string{"field": "state", "regexp": "(CRITICAL"}},
+		},
+		2,
+		&InvalidArgumentError{},
+	},
+	// the signature context retrieves no value to match
+	{
+		FilterConfig{{Type: "eq", Context: "signature", Args: map[string]string{"value": "x"}}},
+		0,
+		&InvalidArgumentError{},
+	},
+}
+
+func TestNewFiltererFromConfig_Errors(t *testing.T) {
+	for i, tt := range configErrorTestTable {
+		_, err := NewFiltererFromConfig(tt.config)
+		configErr, ok := err.(ConfigError)
+		if !ok {
+			t.Errorf("%d: expected a ConfigError, got %v", i, err)
+			continue
+		}
+		if reflect.TypeOf(err) != reflect.TypeOf(tt.expected) || configErr.FilterIndex() != tt.index {
+			t.Errorf("%d: expected %T of filter %d, got %T: %s", i, tt.expected, tt.index, err, err)
+		}
+		errs := ValidateConfig(tt.config, nil)
+		if len(errs) != 1 || errs[0].FilterIndex() != tt.index {
+			t.Errorf("%d: expected a single error of filter %d, got %v", i, tt.index, errs)
+		}
+	}
+	_, err := NewFiltererFromConfig(FilterConfig{{Type: "regexp", Context: "payload map", Args: map[string]string{"field": "state", "regexp": "("}}})
+	var argErr *InvalidArgumentError
+	if !errors.As(err, &argErr) || argErr.Argument != "regexp" || argErr.Unwrap() == nil {
+		t.Errorf("expected invalid regexp argument, got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	// a context that retrieves the sender and a type that matches a suffix
+	RegisterContext("sender", func(args map[string]string) (Retriever, error) {
+		return newEnvelopeValueRetriever("sender"), nil
+	})
+	RegisterType("ends with", func(retriever Retriever, args map[string]string) (Filterer, error) {
+		suffix, err := Argument(args, "suffix")
+		if err != nil {
+			return nil, err
+		}
+		return NewValueFilterer(retriever, func(value []byte) bool {
+			return bytes.HasSuffix(value, []byte(suffix))
+		})
+	})
+	filters, err := NewFiltererFromConfig(FilterConfig{{Type: "ends with", Context: "sender", Args: map[string]string{"suffix": ".example.com"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched, trace, err := Explain(filters, model.Envelope{Sender: []byte("nagios.example.com")})
+	if err != nil || !matched || trace[0].Value != "nagios.example.com" {
+		t.Errorf("expected registered filter to match, got %t %v (%v)", matched, trace, err)
+	}
+	_, err = NewFiltererFromConfig(FilterConfig{{Type: "ends with", Context: "sender"}})
+	if _, ok := err.(*MissingArgumentError); !ok {
+		t.Errorf("expected missing suffix argument, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+// time context fields
+const (
+	// TimeHour is the hour of the day, 0 to 23
+	TimeHour = "hour"
+	// TimeWeekday is the english name of the day of the week, i.e. "Sunday"
+	TimeWeekday = "weekday"
+	// TimeDate is the date as 2006-01-02
+	TimeDate = "date"
+	// TimeOfDay is the time of the day as 15:04
+	TimeOfDay = "time"
+)
+
+// time context sources
+const (
+	// TimeReceived is the time the message was received
+	TimeReceived = "received"
+	// TimeCreated is the time the envelope was published at. Envelopes of publishers
+	// that don't set it have no value
+	TimeCreated = "created"
+)
+
+// timeRetriever retrieves a field of the receive or the creation time of a message
+type timeRetriever struct {
+	field    string
+	source   string
+	location *time.Location
+}
+
+// newTimeContext is the ContextFactory of the "time" context. The arguments are the "field"
+// (default TimeOfDay), the "source" (default TimeReceived) and the "timezone" (default local)
+func newTimeContext(args map[string]string) (Retriever, error) {
+	r := timeRetriever{
+		field:    args["field"],
+		source:   args["source"],
+		location: time.Local,
+	}
+	switch r.field {
+	case "":
+		r.field = TimeOfDay
+	case TimeHour, TimeWeekday, TimeDate, TimeOfDay:
+	default:
+		return nil, &InvalidArgumentError{Argument: "field", Err: fmt.Errorf("unknown time field %q", r.field)}
+	}
+	switch r.source {
+	case "":
+		r.source = TimeReceived
+	case TimeReceived, TimeCreated:
+	default:
+		return nil, &InvalidArgumentError{Argument: "source", Err: fmt.Errorf("unknown time source %q", r.source)}
+	}
+	if timezone, ok := args["timezone"]; ok {
+		var err error
+		r.location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return nil, &InvalidArgumentError{Argument: "timezone", Err: err}
+		}
+	}
+	return r, nil
+}
+
+// messageTimes returns the receive and the creation time of v. The receive time of a bare
+// model.Envelope is the current time
+func messageTimes(v interface{}) (received, created time.Time, err error) {
+	switch m := v.(type) {
+	case *model.Message:
+		return m.Received, m.Created, nil
+	case model.Envelope:
+		if m.CreatedAt != 0 {
+			created = time.Unix(0, m.CreatedAt)
+		}
+		return time.Now(), created, nil
+	default:
+		return received, created, fmt.Errorf("type assertion of %v to Envelope failed", v)
+	}
+}
+
+// timeOf returns the receive or the creation time of v
+func (r timeRetriever) timeOf(v interface{}) (time.Time, error) {
+	received, created, err := messageTimes(v)
+	if err != nil {
+		return received, err
+	}
+	t := received
+	if r.source == TimeCreated {
+		t = created
+	}
+	if t.IsZero() {
+		return t, RetrieverMissingFieldError
+	}
+	return t.In(r.location), nil
+}
+
+// Value implements the Retriever interface
+func (r timeRetriever) Value(v interface{}) ([]byte, error) {
+	t, err := r.timeOf(v)
+	if err != nil {
+		return nil, err
+	}
+	switch r.field {
+	case TimeHour:
+		return []byte(strconv.Itoa(t.Hour())), nil
+	case TimeWeekday:
+		return []byte(t.Weekday().String()), nil
+	case TimeDate:
+		return []byte(t.Format("2006-01-02")), nil
+	default:
+		return []byte(t.Format("15:04")), nil
+	}
+}
+
+// parseTimeOfDay parses a time of the day as 15:04 or 15:04:05 into the seconds since midnight
+func parseTimeOfDay(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("%q is not a time of the day", s)
+	}
+	seconds := 0
+	for i, limit := range []int{24, 60, 60}[:len(parts)] {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 || n >= limit {
+			return 0, fmt.Errorf("%q is not a time of the day", s)
+		}
+		seconds = seconds*60 + n
+	}
+	if len(parts) == 2 {
+		seconds *= 60
+	}
+	return seconds, nil
+}
+
+// newTimeRangeType is the TypeFactory of the "timerange" type. It matches a time of the day
+// from "from" up to, but not including, "to". If "to" is before "from", the range spans midnight
+func newTimeRangeType(retriever Retriever, args map[string]string) (Filterer, error) {
+	bounds := []int{}
+	for _, name := range []string{"from", "to"} {
+		value, err := Argument(args, name)
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := parseTimeOfDay(value)
+		if err != nil {
+			return nil, &InvalidArgumentError{Argument: name, Err: err}
+		}
+		bounds = append(bounds, seconds)
+	}
+	from, to := bounds[0], bounds[1]
+	return NewValueFilterer(retriever, func(value []byte) bool {
+		t, err := parseTimeOfDay(string(value))
+		if err != nil {
+			return false
+		}
+		if from <= to {
+			return t >= from && t < to
+		}
+		return t >= from || t < to
+	})
+}
@@ -0,0 +1,73 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zwopir/eventhandler/model"
+)
+
+var timeFilterTestTable = []struct {
+	filterType string
+	args       map[string]string
+	expected   bool
+}{
+	// the message is received on Sunday, 2026-10-18 at 21:30 UTC and was created at 21:29 UTC
+	{"eq", map[string]string{"field": "hour", "value": "21", "timezone": "UTC"}, true},
+	{"eq", map[string]string{"field": "hour", "value": "23", "timezone": "Europe/Berlin"}, true},
+	{"ne", map[string]string{"field": "weekday", "value": "Sunday", "timezone": "UTC"}, false},
+	{"in", map[string]string{"field": "weekday", "values": "Saturday,Sunday", "timezone": "UTC"}, true},
+	{"eq", map[string]string{"field": "weekday", "value": "Monday", "timezone": "Asia/Tokyo"}, true},
+	{"eq", map[string]string{"field": "date", "value": "2026-10-18", "timezone": "UTC"}, true},
+	{"regexp", map[string]string{"field": "time", "source": "created", "regexp": "^21:29$", "timezone": "UTC"}, true},
+	{"timerange", map[string]string{"from": "08:00", "to": "18:00", "timezone": "UTC"}, false},
+	{"timerange", map[string]string{"from": "21:00", "to": "21:30", "timezone": "UTC"}, false},
+	{"timerange", map[string]string{"from": "21:00", "to": "21:30", "source": "created", "timezone": "UTC"}, true},
+	// the range spans midnight
+	{"timerange", map[string]string{"from": "20:00", "to": "06:00", "timezone": "UTC"}, true},
+	{"timerange", map[string]string{"from": "22:00", "to": "06:00:30", "timezone": "UTC"}, false},
+}
+
+func TestTimeContext(t *testing.T) {
+	msg, err := model.NewMessage(model.Envelope{
+		Payload:   []byte(`{}`),
+		CreatedAt: time.Date(2026, 10, 18, 21, 29, 0, 0, time.UTC).UnixNano(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Received = time.Date(2026, 10, 18, 21, 30, 0, 0, time.UTC)
+	for _, tt := range timeFilterTestTable {
+		filters, err := NewFiltererFromConfig(FilterConfig{{Type: tt.filterType, Context: "time", Args: tt.args}})
+		if err != nil {
+			t.Fatalf("failed to create %s filter: %s", tt.filterType, err)
+		}
+		matched, err := filters.Match(msg)
+		if err != nil || matched != tt.expected {
+			t.Errorf("%s %v: expected %t, got %t (%v)", tt.filterType, tt.args, tt.expected, matched, err)
+		}
+	}
+}
+
+func TestTimeContext_Created(t *testing.T) {
+	// an envelope without creation time doesn't match
+	filters, err := NewFiltererFromConfig(FilterConfig{{Type: "exists", Context: "time", Args: map[string]string{"source": "created"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched, trace, err := Explain(filters, model.Envelope{})
+	if err != nil || matched || !trace[0].Missing {
+		t.Errorf("expected missing creation time, got %t %v (%v)", matched, trace, err)
+	}
+	for _, args := range []map[string]string{
+		{"field": "minute"},
+		{"source": "published"},
+		{"timezone": "Mars/Olympus_Mons"},
+		{"from": "8:00", "to": "25:00"},
+	} {
+		_, err := NewFiltererFromConfig(FilterConfig{{Type: "timerange", Context: "time", Args: args}})
+		if err == nil {
+			t.Errorf("%v: expected filter creation to fail", args)
+		}
+	}
+}
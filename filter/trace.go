@@ -0,0 +1,201 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TraceEntry represents the evaluation of a single filter
+type TraceEntry struct {
+	Name    string `json:"name"`
+	Value   string `json:"value,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+	Matched bool   `json:"matched"`
+	// Skipped is set for stateful filters that weren't evaluated because another filter didn't match
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// String formats the entry for logs and terminals
+func (e TraceEntry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: matched=%t", e.Name, e.Matched)
+	switch {
+	case e.Skipped:
+		b.WriteString(" skipped")
+	case e.Missing:
+		b.WriteString(" value missing")
+	case e.Value != "":
+		fmt.Fprintf(&b, " value=%q", e.Value)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, " error=%q", e.Error)
+	}
+	return b.String()
+}
+
+// Trace represents the evaluation of all filters of a Filterer
+type Trace []TraceEntry
+
+// Tracer is implemented by a Filterer that can explain its evaluation. Unlike Match,
+// Trace evaluates all filters, even after the first mismatch
+type Tracer interface {
+	Trace(v interface{}) (bool, Trace, error)
+}
+
+// Explain evaluates f with v and returns the trace of the evaluation. A Filterer that
+// doesn't implement Tracer is traced as a single entry
+func Explain(f Filterer, v interface{}) (bool, Trace, error) {
+	if t, ok := f.(Tracer); ok {
+		return t.Trace(v)
+	}
+	matched, err := f.Match(v)
+	entry := TraceEntry{Name: "filter", Matched: matched}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return matched, Trace{entry}, err
+}
+
+// Rejection evaluates f like Match and returns the name of the filter that didn't match v
+// or failed, named like in traces. Unlike Explain, it stops at the first such filter
+func Rejection(f Filterer, v interface{}) (bool, string, error) {
+	if battery, ok := f.(FilterBattery); ok {
+		i, err := battery.rejecting(v)
+		if i < 0 {
+			return true, "", nil
+		}
+		return false, filterTraceName(battery[i], i), err
+	}
+	matched, err := f.Match(v)
+	if matched && err == nil {
+		return true, "", nil
+	}
+	return false, "filter", err
+}
+
+// Trace implements the Tracer interface. The battery matches if all filters match, the
+// returned error is the first error of a filter. Like Match, it evaluates stateful filters
+// after all other filters and only while all filters matched, the others are skipped
+func (f FilterBattery) Trace(v interface{}) (bool, Trace, error) {
+	var (
+		firstErr error
+		traces   = make([]Trace, len(f))
+	)
+	matched := true
+	for _, stateful := range []bool{false, true} {
+		for i, filter := range f {
+			if isStateful(filter) != stateful {
+				continue
+			}
+			if stateful && !matched {
+				traces[i] = Trace{{Name: filterTraceName(filter, i), Skipped: true}}
+				continue
+			}
+			var (
+				m   bool
+				err error
+			)
+			if tracer, ok := filter.(Tracer); ok {
+				m, traces[i], err = tracer.Trace(v)
+			} else {
+				m, err = filter.Match(v)
+				entry := TraceEntry{Name: filterTraceName(filter, i), Matched: m}
+				if err != nil {
+					entry.Error = err.Error()
+				}
+				traces[i] = Trace{entry}
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			matched = matched && m && err == nil
+		}
+	}
+	trace := Trace{}
+	for _, t := range traces {
+		trace = append(trace, t...)
+	}
+	return matched, trace, firstErr
+}
+
+// filterTraceName returns the name of the filter at index i of a battery in traces
+func filterTraceName(f Filterer, i int) string {
+	if nf, ok := f.(namedFilter); ok {
+		return nf.name
+	}
+	return fmt.Sprintf("filter%d", i)
+}
+
+// valueFilter matches the value retrieved by its retriever with its predicate.
+// A missing value doesn't match
+type valueFilter struct {
+	retriever Retriever
+	predicate func(value []byte) bool
+}
+
+// Match implements the Filterer interface
+func (f valueFilter) Match(v interface{}) (bool, error) {
+	matched, _, err := f.match(v)
+	// consider match tries on a non existent field as a non-match
+	if err == RetrieverMissingFieldError {
+		return false, nil
+	}
+	return matched, err
+}
+
+// match returns the match result and the retrieved value. A missing value is
+// returned as RetrieverMissingFieldError
+func (f valueFilter) match(v interface{}) (bool, []byte, error) {
+	value, err := f.retriever.Value(v)
+	if err != nil {
+		return false, nil, err
+	}
+	return f.predicate(value), value, nil
+}
+
+// namedFilter is a Filterer with a name used in traces
+type namedFilter struct {
+	Filterer
+	name string
+}
+
+// Trace implements the Tracer interface
+func (f namedFilter) Trace(v interface{}) (bool, Trace, error) {
+	entry := TraceEntry{Name: f.name}
+	var err error
+	if vf, ok := f.Filterer.(valueFilter); ok {
+		var value []byte
+		entry.Matched, value, err = vf.match(v)
+		entry.Value = string(value)
+		if err == RetrieverMissingFieldError {
+			entry.Missing = true
+			err = nil
+		}
+	} else {
+		entry.Matched, err = f.Filterer.Match(v)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry.Matched, Trace{entry}, err
+}
+
+// filterName returns the configured name of a filter or a name derived from its settings,
+// i.e. "regexp payload map check_name"
+func filterName(cf FilterSettings) string {
+	if cf.Name != "" {
+		return cf.Name
+	}
+	parts := []string{cf.Type}
+	if cf.Context != "" && cf.Context != cf.Type {
+		parts = append(parts, cf.Context)
+	}
+	for _, arg := range []string{"field", "path", "template"} {
+		if value, ok := cf.Args[arg]; ok {
+			parts = append(parts, value)
+			break
+		}
+	}
+	return strings.Join(parts, " ")
+}
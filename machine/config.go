@@ -1,11 +1,13 @@
 package machine
 
-// CoordinatorConfig represents the settings that specified the executed command
+import "github.com/zwopir/eventhandler/action"
+
+// CoordinatorConfig represents the settings of a handler, the action it runs and
+// the limits of its dispatching
 type CoordinatorConfig struct {
-	Cmd           string   `yaml:"cmd"`
-	CmdArgs       []string `yaml:"cmdargs"`
-	Timeout       string   `yaml:"timeout"`
-	StdinTemplate string   `yaml:"stdintemplate"`
-	Blackout      string   `yaml:"blackout"`
-	MaxDispatches int64    `yaml:"maxdispatches"`
+	Name          string                    `yaml:"name"`
+	Action        action.Config             `yaml:",inline" mapstructure:",squash"`
+	Blackout      string                    `yaml:"blackout"`
+	MaxDispatches int64                     `yaml:"maxdispatches"`
+	Maintenance   []MaintenanceWindowConfig `yaml:"maintenance"`
 }
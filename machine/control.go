@@ -0,0 +1,214 @@
+package machine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/go-nats"
+	"github.com/prometheus/common/log"
+)
+
+// DefaultControlSubject is the nats subject subscribers listen on for control messages.
+// Additionally every subscriber listens on DefaultControlSubject + "." + hostname
+const DefaultControlSubject = "eventhandler.control"
+
+// control commands understood by a coordinator
+const (
+	ControlStatus          = "status"
+	ControlCounters        = "counters"
+	ControlConfigHash      = "config-hash"
+	ControlUptime          = "uptime"
+	ControlPause           = "pause"
+	ControlResume          = "resume"
+	ControlResetBlackout   = "reset-blackout"
+	ControlResetDispatches = "reset-dispatches"
+	ControlMute            = "mute"
+	ControlTrace           = "trace"
+)
+
+// ControlCommands lists all control commands
+var ControlCommands = []string{
+	ControlStatus,
+	ControlCounters,
+	ControlConfigHash,
+	ControlUptime,
+	ControlPause,
+	ControlResume,
+	ControlResetBlackout,
+	ControlResetDispatches,
+	ControlMute,
+	ControlTrace,
+}
+
+// ControlMessage represents a json encoded runtime command sent to running subscribers.
+// If the message is sent as a nats request, the subscriber answers with a ControlReply
+type ControlMessage struct {
+	// Command is the requested operation, i.e. "mute"
+	Command string `json:"command"`
+	// Handler restricts the message to the handler with the given name.
+	// If empty, all handlers apply the message
+	Handler string `json:"handler,omitempty"`
+	// Duration is the duration of a mute. A zero duration lifts the mute
+	Duration string `json:"duration,omitempty"`
+}
+
+// ControlReply represents the json encoded answer to a ControlMessage
+type ControlReply struct {
+	Host       string        `json:"host"`
+	Handler    string        `json:"handler"`
+	Command    string        `json:"command"`
+	Error      string        `json:"error,omitempty"`
+	Status     *Status       `json:"status,omitempty"`
+	Counters   *Counters     `json:"counters,omitempty"`
+	ConfigHash string        `json:"config_hash,omitempty"`
+	Uptime     string        `json:"uptime,omitempty"`
+	Trace      *MessageTrace `json:"trace,omitempty"`
+}
+
+// Status represents the runtime status of a coordinator
+type Status struct {
+	Started       time.Time `json:"started"`
+	Uptime        string    `json:"uptime"`
+	ConfigHash    string    `json:"config_hash"`
+	Paused        bool      `json:"paused"`
+	MutedUntil    time.Time `json:"muted_until,omitempty"`
+	Maintenance   string    `json:"maintenance,omitempty"`
+	BlackoutUntil time.Time `json:"blackout_until,omitempty"`
+	Dispatches    int64     `json:"dispatches"`
+	MaxDispatches int64     `json:"max_dispatches"`
+	Counters      Counters  `json:"counters"`
+}
+
+// ControlConfig configures the control plane of a coordinator
+type ControlConfig struct {
+	// Subject is the broadcast control subject
+	Subject string
+	// Hostname identifies the subscriber, requests on Subject.Hostname are only
+	// answered by this subscriber
+	Hostname string
+	// Handler is the name of the coordinated handler
+	Handler string
+	// ConfigHash identifies the loaded configuration
+	ConfigHash string
+}
+
+// NatsControl subscribes the coordinator to control messages on the broadcast and the
+// host specific control subject. Messages sent as requests are answered with a ControlReply
+func (c Coordinator) NatsControl(cfg ControlConfig) error {
+	jsonConn, err := nats.NewEncodedConn(c.encConn.Conn, nats.JSON_ENCODER)
+	if err != nil {
+		return err
+	}
+	for _, subject := range []string{cfg.Subject, cfg.Subject + "." + cfg.Hostname} {
+		_, err = jsonConn.Subscribe(subject, func(subject, reply string, m *ControlMessage) {
+			if m.Handler != "" && m.Handler != cfg.Handler {
+				log.Debugf("ignoring control message for handler %q", m.Handler)
+				return
+			}
+			r := c.handleControlMessage(cfg, m)
+			if reply == "" {
+				return
+			}
+			err := jsonConn.Publish(reply, r)
+			if err != nil {
+				log.Errorf("failed to reply to control message: %s", err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleControlMessage applies a control message to the coordinator and returns the reply
+func (c Coordinator) handleControlMessage(cfg ControlConfig, m *ControlMessage) *ControlReply {
+	r := &ControlReply{
+		Host:    cfg.Hostname,
+		Handler: cfg.Handler,
+		Command: m.Command,
+	}
+	switch m.Command {
+	case ControlStatus:
+		r.Status = c.status(cfg)
+	case ControlCounters:
+		counters, _ := c.state.snapshot()
+		r.Counters = &counters
+	case ControlConfigHash:
+		r.ConfigHash = cfg.ConfigHash
+	case ControlUptime:
+		_, started := c.state.snapshot()
+		r.Uptime = time.Since(started).String()
+	case ControlPause:
+		c.state.update(func(s *dispatchState) { s.paused = true })
+		log.Info("dispatching paused by control message")
+		r.Status = c.status(cfg)
+	case ControlResume:
+		c.state.update(func(s *dispatchState) { s.paused = false })
+		log.Info("dispatching resumed by control message")
+		r.Status = c.status(cfg)
+	case ControlResetBlackout:
+		c.state.update(func(s *dispatchState) { s.lastDispatched = time.Time{} })
+		log.Info("blackout reset by control message")
+		r.Status = c.status(cfg)
+	case ControlResetDispatches:
+		c.state.update(func(s *dispatchState) { s.dispatches = 0 })
+		log.Info("dispatch counter reset by control message")
+		r.Status = c.status(cfg)
+	case ControlMute:
+		d := time.Duration(0)
+		if m.Duration != "" {
+			var err error
+			d, err = time.ParseDuration(m.Duration)
+			if err != nil {
+				r.Error = fmt.Sprintf("invalid mute duration %q: %s", m.Duration, err)
+				log.Error(r.Error)
+				return r
+			}
+		}
+		c.Mute(d)
+		if d > 0 {
+			log.Infof("muted by control message for %s", d)
+		} else {
+			log.Info("mute lifted by control message")
+		}
+		r.Status = c.status(cfg)
+	case ControlTrace:
+		// the evaluation of the next message is traced for the following request
+		c.state.update(func(s *dispatchState) {
+			r.Trace = s.lastTrace
+			s.traceNext = true
+		})
+		if r.Trace == nil {
+			r.Error = "no message traced yet, the next received message is traced"
+		}
+	default:
+		r.Error = fmt.Sprintf("unknown control command %q", m.Command)
+		log.Error(r.Error)
+	}
+	return r
+}
+
+// status returns the current status of the coordinator
+func (c Coordinator) status(cfg ControlConfig) *Status {
+	now := time.Now()
+	s := &Status{
+		ConfigHash:    cfg.ConfigHash,
+		MaxDispatches: c.maxDispatches,
+	}
+	c.state.update(func(state *dispatchState) {
+		s.Started = state.started
+		s.Paused = state.paused
+		s.Dispatches = state.dispatches
+		s.Counters = state.counters.copy()
+		if blackoutUntil := state.lastDispatched.Add(c.blackout); blackoutUntil.After(now) {
+			s.BlackoutUntil = blackoutUntil
+		}
+	})
+	s.Uptime = now.Sub(s.Started).String()
+	s.MutedUntil = c.maintenance.mutedUntilAfter(now)
+	if _, name, ok := c.maintenance.check(now); ok {
+		s.Maintenance = name
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/model"
+)
+
+var controlConfig = ControlConfig{
+	Subject:    DefaultControlSubject,
+	Hostname:   "testhost",
+	Handler:    "testhandler",
+	ConfigHash: "testhash",
+}
+
+func TestCoordinator_handleControlMessage(t *testing.T) {
+	coordinator := Coordinator{
+		blackout:      time.Hour,
+		maxDispatches: 1,
+		maintenance:   &maintenance{},
+		state:         newDispatchState(),
+	}
+	coordinator.state.dispatched(time.Now())
+
+	r := coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlStatus})
+	if r.Status == nil || r.Status.ConfigHash != "testhash" || r.Host != "testhost" {
+		t.Fatalf("unexpected status reply %+v", r)
+	}
+	if r.Status.BlackoutUntil.IsZero() || r.Status.Dispatches != 1 || r.Status.Counters.Dispatched != 1 {
+		t.Errorf("expected a blackout and one dispatch, got %+v", r.Status)
+	}
+
+	r = coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlResetBlackout})
+	if !r.Status.BlackoutUntil.IsZero() || coordinator.inBlackout() {
+		t.Error("expected the blackout to be reset")
+	}
+	r = coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlResetDispatches})
+	if r.Status.Dispatches != 0 || r.Status.Counters.Dispatched != 1 {
+		t.Errorf("expected the dispatch counter to be reset, got %+v", r.Status)
+	}
+
+	coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlPause})
+	if !coordinator.state.isPaused() {
+		t.Error("expected the coordinator to be paused")
+	}
+	coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlResume})
+	if coordinator.state.isPaused() {
+		t.Error("expected the coordinator to be resumed")
+	}
+
+	r = coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: "reboot"})
+	if r.Error == "" {
+		t.Error("expected an error for an unknown command")
+	}
+}
+
+func TestCoordinator_Mute(t *testing.T) {
+	coordinator := Coordinator{maintenance: &maintenance{}, state: newDispatchState()}
+	coordinator.Mute(time.Hour)
+	mode, _, ok := coordinator.maintenance.check(time.Now())
+	if !ok || mode != MaintenanceSuppress {
+		t.Error("expected a muted coordinator to suppress messages")
+	}
+	r := coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlMute, Duration: "0s"})
+	if _, _, ok := coordinator.maintenance.check(time.Now()); ok || !r.Status.MutedUntil.IsZero() {
+		t.Error("expected the mute to be lifted")
+	}
+	r = coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlMute, Duration: "forever"})
+	if r.Error == "" {
+		t.Error("expected an error for an invalid mute duration")
+	}
+}
+
+func TestCoordinator_handleControlMessage2(t *testing.T) {
+	coordinator := Coordinator{maintenance: &maintenance{}, state: newDispatchState()}
+	r := coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlTrace})
+	if r.Error == "" {
+		t.Error("expected an error before a message is received")
+	}
+	msg := &model.Message{CorrelationID: "testUUID", Subject: "eventhandler"}
+	trace := filter.Trace{{Name: "regexp envelope sender", Value: "sender", Matched: false}}
+	coordinator.recordTrace(msg, false, trace)
+	r = coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlTrace})
+	if r.Trace == nil || r.Trace.CorrelationID != "testUUID" || !reflect.DeepEqual(r.Trace.Filters, trace) {
+		t.Errorf("unexpected trace reply %+v", r.Trace)
+	}
+}
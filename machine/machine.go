@@ -1,38 +1,50 @@
 package machine
 
 import (
-	"github.com/zwopir/eventhandler/filter"
-	"github.com/zwopir/eventhandler/model"
+	"context"
 	"fmt"
+	"time"
+
 	"github.com/nats-io/go-nats"
 	"github.com/nats-io/go-nats/encoders/protobuf"
 	"github.com/prometheus/common/log"
-	"time"
+	"github.com/zwopir/eventhandler/action"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/model"
 )
 
-// Coordinator dispatches messages read from nats to an actionFunc (func(interface{}) error)
+// Coordinator dispatches messages read from nats to an action.Action
 type Coordinator struct {
+	// the context passed to actions, it is cancelled on shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
 	// the message channel
-	envelopeCh chan model.Envelope
+	envelopeCh chan delivery
 	// the encoded connection to nats (protobuf.PROTOBUF_ENCODER)
 	encConn *nats.EncodedConn
 	// channel to signalize a coordinator shutdown
 	done chan struct{}
-	// the time of the last successful message dispatch
-	lastDispatched time.Time
 	// after a successful message dispatch the coordinator enters a
 	// blackout in which all messages are ignored
 	blackout time.Duration
-	// number of successful dispatches
-	dispatches int64
 	// the coordinator only dispatches a certain number of messages
 	// If set to 0, the number of dispatches are unlimited
 	maxDispatches int64
+	// maintenance windows and runtime mute in which matching messages aren't dispatched
+	maintenance *maintenance
+	// counters, pause and the dispatch history shared with the control plane
+	state *dispatchState
+}
+
+// delivery represents an envelope received on a nats subject
+type delivery struct {
+	subject  string
+	envelope model.Envelope
 }
 
 // NewCoordinator creates a new coordinator
 func NewCoordinator(conn *nats.Conn, blackout string, maxDispatches int64) (Coordinator, error) {
-	envelopeCh := make(chan model.Envelope)
+	envelopeCh := make(chan delivery)
 	done := make(chan struct{})
 	encConn, err := nats.NewEncodedConn(conn, protobuf.PROTOBUF_ENCODER)
 	if err != nil {
@@ -42,48 +54,105 @@ func NewCoordinator(conn *nats.Conn, blackout string, maxDispatches int64) (Coor
 	if err != nil {
 		return Coordinator{}, fmt.Errorf("failed to initialize coordinator: %s", err)
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return Coordinator{
+		ctx:           ctx,
+		cancel:        cancel,
 		envelopeCh:    envelopeCh,
 		encConn:       encConn,
 		done:          done,
 		blackout:      bo,
-		dispatches:    0,
 		maxDispatches: maxDispatches,
+		maintenance:   &maintenance{},
+		state:         newDispatchState(),
 	}, nil
 }
 
+// SetMaintenanceWindows configures the maintenance windows of the coordinator
+func (c Coordinator) SetMaintenanceWindows(configs []MaintenanceWindowConfig) error {
+	windows := []maintenanceWindow{}
+	for _, cfg := range configs {
+		w, err := newMaintenanceWindow(cfg)
+		if err != nil {
+			return err
+		}
+		windows = append(windows, w)
+	}
+	c.maintenance.set(windows)
+	return nil
+}
+
+// Mute suppresses all messages for the duration d. A non-positive duration lifts the mute
+func (c Coordinator) Mute(d time.Duration) {
+	c.maintenance.mute(d)
+}
+
 // inBlackout indicates if the coordinator is in blackout
 func (c Coordinator) inBlackout() bool {
-	return c.lastDispatched.Add(c.blackout).After(time.Now())
+	return c.state.blackoutUntil(c.blackout).After(time.Now())
 }
 
-// NatsListen connects the coordinator to the provided nats topic
-func (c Coordinator) NatsListen(subject string) error {
-	_, err := c.encConn.Subscribe(subject, func(m model.Envelope) {
-		c.envelopeCh <- m
-	})
-	if err != nil {
-		return err
+// inMaintenance indicates if the message falls into a maintenance window or a runtime mute
+func (c Coordinator) inMaintenance(message *model.Message) bool {
+	mode, name, ok := c.maintenance.check(time.Now())
+	if !ok {
+		return false
+	}
+	if mode == MaintenanceLog {
+		log.Warnf("maintenance window %q is active, not dispatching message %s", name, message.CorrelationID)
+	} else {
+		log.Infof("discarding message because maintenance window %q is active", name)
+	}
+	return true
+}
+
+// NatsListen connects the coordinator to the provided nats subjects. Subjects may
+// contain the nats wildcards "*" and ">"
+func (c Coordinator) NatsListen(subjects ...string) error {
+	for _, subject := range subjects {
+		_, err := c.encConn.Subscribe(subject, func(subject, reply string, m model.Envelope) {
+			c.envelopeCh <- delivery{subject: subject, envelope: m}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %s", subject, err)
+		}
+		log.Infof("listening on subject %s", subject)
 	}
 	return nil
 }
 
-// Dispatch dispatches the messages received from nats to the actionFunc.
+// Dispatch dispatches the messages received from nats to the action.
 // Messages are filtered and if the filter passes, the message is checked
 // against the dispatch limit and the blackout
-func (c Coordinator) Dispatch(filters filter.Filterer, actionFunc func(interface{}) error) {
+func (c Coordinator) Dispatch(filters filter.Filterer, act action.Action) {
 	log.Infof("starting to dispatch with dispatch limit = %d and blackout = %s", c.maxDispatches, c.blackout)
 	go func() {
-		for message := range c.envelopeCh {
+		for d := range c.envelopeCh {
+			c.state.update(func(s *dispatchState) { s.counters.Received += 1 })
 			dispatchMessage := true
-			matched, err := filters.Match(message)
+			message, err := model.NewMessage(d.envelope)
+			if err != nil {
+				log.Errorf("failed to decode message %s received on %s: %s", model.CorrelationIDString(d.envelope.CorrelationId), d.subject, err)
+				c.state.update(func(s *dispatchState) { s.counters.Errors += 1 })
+				continue
+			}
+			message.Subject = d.subject
+			matched, rejectedBy, err := c.match(filters, message)
 			if err != nil {
-				log.Errorf("failed to apply matcher on %s: %s", message, err)
+				log.Errorf("failed to apply matcher on %s: %s", message.CorrelationID, err)
+				c.state.update(func(s *dispatchState) { s.counters.Errors += 1 })
 				continue
 			}
 			switch {
 			case !matched:
-				log.Infof("message %s doesn't match the provided filters, discarding it", message)
+				log.Infof("message %s received on %s doesn't match the provided filters, discarding it", message.CorrelationID, message.Subject)
+				dispatchMessage = false
+				break
+			case c.state.isPaused():
+				log.Info("discarding message because dispatching is paused")
+				dispatchMessage = false
+				break
+			case c.inMaintenance(message):
 				dispatchMessage = false
 				break
 			case c.inBlackout():
@@ -94,20 +163,35 @@ func (c Coordinator) Dispatch(filters filter.Filterer, actionFunc func(interface
 				log.Debug("coordinator has no dispatch limit")
 				dispatchMessage = dispatchMessage && true
 				break
-			case c.dispatches >= c.maxDispatches:
+			case c.state.dispatchCount() >= c.maxDispatches:
 				log.Infof("dispatch limit exceeded (limit is %d)", c.maxDispatches)
 				dispatchMessage = false
 				break
 			}
+			c.state.update(func(s *dispatchState) {
+				switch {
+				case !matched:
+					s.counters.Filtered += 1
+					if s.counters.Rejected == nil {
+						s.counters.Rejected = map[string]int64{}
+					}
+					s.counters.Rejected[rejectedBy] += 1
+				case !dispatchMessage:
+					s.counters.Matched += 1
+					s.counters.Discarded += 1
+				default:
+					s.counters.Matched += 1
+				}
+			})
 
 			if dispatchMessage {
-				log.Debugf("dispatching message %s\n", message)
-				err := actionFunc(message)
+				log.Debugf("dispatching message %s received on %s", message.CorrelationID, message.Subject)
+				err := c.runAction(act, message)
 				if err != nil {
-					log.Errorf("action func in dispatcher failed: %s", err)
+					log.Errorf("action in dispatcher failed: %s", err)
+					c.state.update(func(s *dispatchState) { s.counters.Failed += 1 })
 				}
-				c.lastDispatched = time.Now()
-				c.dispatches += 1
+				c.state.dispatched(time.Now())
 			}
 			select {
 			case <-c.done:
@@ -119,10 +203,70 @@ func (c Coordinator) Dispatch(filters filter.Filterer, actionFunc func(interface
 	}()
 }
 
+// SetTracing enables the trace of the filter evaluation of every received message, i.e. at
+// debug level. Otherwise only the message after a trace request on the control subject is traced
+func (c Coordinator) SetTracing(enabled bool) {
+	c.state.update(func(s *dispatchState) { s.tracing = enabled })
+}
+
+// match evaluates the filters with the message and returns the name of the filter that
+// rejected it. Unless the message is traced, the evaluation stops at that filter
+func (c Coordinator) match(filters filter.Filterer, message *model.Message) (bool, string, error) {
+	if !c.state.traceMessage() {
+		return filter.Rejection(filters, message)
+	}
+	matched, trace, err := filter.Explain(filters, message)
+	c.recordTrace(message, matched, trace)
+	// like Match, ignore the errors of filters after the first mismatch
+	for _, entry := range trace {
+		if entry.Matched || entry.Skipped {
+			continue
+		}
+		if entry.Error == "" {
+			return false, entry.Name, nil
+		}
+		return false, entry.Name, err
+	}
+	return matched, "", err
+}
+
+// recordTrace logs the filter trace of the message at debug level and keeps it for the control plane
+func (c Coordinator) recordTrace(message *model.Message, matched bool, trace filter.Trace) {
+	for _, entry := range trace {
+		log.Debugf("[%s] filter %s", message.CorrelationID, entry)
+	}
+	t := &MessageTrace{
+		CorrelationID: message.CorrelationID,
+		Subject:       message.Subject,
+		Received:      time.Now(),
+		Matched:       matched,
+		Filters:       trace,
+	}
+	c.state.update(func(s *dispatchState) { s.lastTrace = t })
+}
+
+// runAction runs the action with the message
+func (c Coordinator) runAction(act action.Action, msg *model.Message) error {
+	log.Infof("starting action with message %s", msg.CorrelationID)
+	result, err := act.Run(c.ctx, msg)
+	if result != nil {
+		log.Infof("%s action with message %s finished with exit code %d after %s",
+			result.Type, msg.CorrelationID, result.ExitCode, result.Duration)
+		log.Debugf("action stdout returned %s", result.Stdout)
+		if err != nil {
+			log.Errorf("action stderr returned %s", result.Stderr)
+		} else {
+			log.Debugf("action stderr returned %s", result.Stderr)
+		}
+	}
+	return err
+}
+
 // Shutdown stops the coordinator and closes all connections
 func (c Coordinator) Shutdown() {
 	defer close(c.done)
 	defer close(c.envelopeCh)
 	log.Info("shutting down coordinator...")
+	c.cancel()
 	c.encConn.Close()
 }
@@ -1,16 +1,19 @@
 package machine
 
 import (
-	"github.com/zwopir/eventhandler/filter"
-	"github.com/zwopir/eventhandler/model"
+	"context"
 	"fmt"
-	"github.com/nats-io/gnatsd/server"
-	testserver "github.com/nats-io/gnatsd/test"
-	"github.com/nats-io/go-nats"
 	"net"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/nats-io/gnatsd/server"
+	testserver "github.com/nats-io/gnatsd/test"
+	"github.com/nats-io/go-nats"
+	"github.com/zwopir/eventhandler/action"
+	"github.com/zwopir/eventhandler/filter"
+	"github.com/zwopir/eventhandler/model"
 )
 
 var (
@@ -311,14 +314,10 @@ func testCoordinatorDispatch(
 		recv := make(chan model.Envelope)
 
 		// start dispatcher
-		coordinator.Dispatch(filters, func(message interface{}) error {
-			msg, ok := message.(model.Envelope)
-			if !ok {
-				t.Error("assertion failed")
-			}
-			recv <- msg
-			return nil
-		})
+		coordinator.Dispatch(filters, action.Func(func(ctx context.Context, msg *model.Message) (*action.Result, error) {
+			recv <- msg.Envelope
+			return &action.Result{Type: "test"}, nil
+		}))
 
 		// collect dispatched messages in a go routine
 		dispatchedMessages := []model.Envelope{}
@@ -335,15 +334,15 @@ func testCoordinatorDispatch(
 
 		// send test messages to coordinator message chan
 		for _, messageToDispatch := range tt.messagesToDispatch {
-			t.Logf("sending %s to message channel", messageToDispatch)
-			coordinator.envelopeCh <- messageToDispatch
+			t.Logf("sending %v to message channel", messageToDispatch)
+			coordinator.envelopeCh <- delivery{subject: subject, envelope: messageToDispatch}
 			time.Sleep(sleep)
 		}
 		time.Sleep(500 * time.Millisecond)
 		close(coordinator.done)
 
 		if !reflect.DeepEqual(dispatchedMessages, tt.receivedMessages) {
-			t.Errorf("expected the following messages %s, got %s", tt.receivedMessages, dispatchedMessages)
+			t.Errorf("expected the following messages %v, got %v", tt.receivedMessages, dispatchedMessages)
 		}
 	}
 }
@@ -389,3 +388,36 @@ func TestCoordinator_Shutdown(t *testing.T) {
 		t.Error("done chan hasn't been closed")
 	}
 }
+
+func TestCoordinator_match(t *testing.T) {
+	coordinator := Coordinator{maintenance: &maintenance{}, state: newDispatchState()}
+	filters, err := filter.NewFiltererFromConfig(filter.FilterConfig{
+		{Name: "enough attempts", Type: "ge", Context: "payload map", Args: map[string]string{"field": "attempt", "value": "3"}},
+		{Type: "regexp", Context: "payload template", Args: map[string]string{"template": "{{ .missing.key }}", "regexp": "x"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := model.NewMessage(model.Envelope{Payload: []byte(`{"attempt":2}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// untraced and traced evaluations ignore the failing filter after the first mismatch
+	for _, traced := range []bool{false, true} {
+		if traced {
+			coordinator.handleControlMessage(controlConfig, &ControlMessage{Command: ControlTrace})
+		}
+		matched, rejectedBy, err := coordinator.match(filters, msg)
+		if matched || rejectedBy != "enough attempts" || err != nil {
+			t.Errorf("traced=%t: expected a rejection by enough attempts, got %t, %q (%v)", traced, matched, rejectedBy, err)
+		}
+		lastTrace := coordinator.state.lastTrace
+		if (lastTrace != nil) != traced {
+			t.Errorf("traced=%t: unexpected trace %+v", traced, lastTrace)
+		}
+	}
+	// a trace request traces a single message
+	if coordinator.state.traceMessage() {
+		t.Error("expected the trace request to be consumed")
+	}
+}
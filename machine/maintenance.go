@@ -0,0 +1,259 @@
+package machine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaintenanceSuppress discards matching messages during a maintenance window
+	MaintenanceSuppress = "suppress"
+	// MaintenanceLog logs matching messages during a maintenance window without dispatching them
+	MaintenanceLog = "log"
+)
+
+// MaintenanceWindowConfig represents a maintenance window in the handler config.
+// A window is either recurring (Schedule is a cron expression and Duration is the length
+// of the window) or a fixed calendar window between Start and End (RFC3339 timestamps)
+type MaintenanceWindowConfig struct {
+	Name     string `yaml:"name"`
+	Schedule string `yaml:"schedule"`
+	Duration string `yaml:"duration"`
+	Start    string `yaml:"start"`
+	End      string `yaml:"end"`
+	Mode     string `yaml:"mode"`
+}
+
+// maintenanceWindow is a parsed MaintenanceWindowConfig
+type maintenanceWindow struct {
+	name     string
+	mode     string
+	schedule *cronSchedule
+	duration time.Duration
+	start    time.Time
+	end      time.Time
+}
+
+// newMaintenanceWindow parses a MaintenanceWindowConfig
+func newMaintenanceWindow(cfg MaintenanceWindowConfig) (maintenanceWindow, error) {
+	var err error
+	w := maintenanceWindow{
+		name: cfg.Name,
+		mode: cfg.Mode,
+	}
+	switch w.mode {
+	case "":
+		w.mode = MaintenanceSuppress
+	case MaintenanceSuppress, MaintenanceLog:
+	default:
+		return w, fmt.Errorf("maintenance window %q: unknown mode %q", cfg.Name, cfg.Mode)
+	}
+	switch {
+	case cfg.Schedule != "" && (cfg.Start != "" || cfg.End != ""):
+		return w, fmt.Errorf("maintenance window %q: schedule and start/end are mutually exclusive", cfg.Name)
+	case cfg.Schedule != "":
+		w.schedule, err = parseCronSchedule(cfg.Schedule)
+		if err != nil {
+			return w, fmt.Errorf("maintenance window %q: %s", cfg.Name, err)
+		}
+		w.duration, err = time.ParseDuration(cfg.Duration)
+		if err != nil {
+			return w, fmt.Errorf("maintenance window %q: failed to parse duration: %s", cfg.Name, err)
+		}
+		if w.duration <= 0 {
+			return w, fmt.Errorf("maintenance window %q: duration must be positive", cfg.Name)
+		}
+	case cfg.Start != "" && cfg.End != "":
+		w.start, err = time.Parse(time.RFC3339, cfg.Start)
+		if err != nil {
+			return w, fmt.Errorf("maintenance window %q: failed to parse start: %s", cfg.Name, err)
+		}
+		w.end, err = time.Parse(time.RFC3339, cfg.End)
+		if err != nil {
+			return w, fmt.Errorf("maintenance window %q: failed to parse end: %s", cfg.Name, err)
+		}
+		if !w.end.After(w.start) {
+			return w, fmt.Errorf("maintenance window %q: end must be after start", cfg.Name)
+		}
+	default:
+		return w, fmt.Errorf("maintenance window %q: either schedule and duration or start and end are required", cfg.Name)
+	}
+	return w, nil
+}
+
+// Validate checks the maintenance window config
+func (cfg MaintenanceWindowConfig) Validate() error {
+	_, err := newMaintenanceWindow(cfg)
+	return err
+}
+
+// active indicates if t is inside the maintenance window
+func (w maintenanceWindow) active(t time.Time) bool {
+	if w.schedule == nil {
+		return !t.Before(w.start) && t.Before(w.end)
+	}
+	// the window is active if the schedule fired within the last duration
+	first := t.Add(-w.duration).Truncate(time.Minute).Add(time.Minute)
+	for m := t.Truncate(time.Minute); !m.Before(first); m = m.Add(-time.Minute) {
+		if w.schedule.matches(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenance holds the maintenance windows and the runtime mute of a coordinator.
+// It is shared between the copies of a Coordinator and safe for concurrent use
+type maintenance struct {
+	mu         sync.Mutex
+	windows    []maintenanceWindow
+	mutedUntil time.Time
+}
+
+// set replaces the configured maintenance windows
+func (m *maintenance) set(windows []maintenanceWindow) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windows = windows
+}
+
+// mute suppresses all messages until now + d. A non-positive d lifts the mute
+func (m *maintenance) mute(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d <= 0 {
+		m.mutedUntil = time.Time{}
+		return
+	}
+	m.mutedUntil = time.Now().Add(d)
+}
+
+// mutedUntilAfter returns the end of the runtime mute if it is active at t
+func (m *maintenance) mutedUntilAfter(t time.Time) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.Before(m.mutedUntil) {
+		return m.mutedUntil
+	}
+	return time.Time{}
+}
+
+// check returns the mode and the name of the window that is active at t.
+// ok is false if no window is active
+func (m *maintenance) check(t time.Time) (mode, name string, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.Before(m.mutedUntil) {
+		return MaintenanceSuppress, "mute", true
+	}
+	for _, w := range m.windows {
+		if w.active(t) {
+			return w.mode, w.name, true
+		}
+	}
+	return "", "", false
+}
+
+// cronSchedule is a parsed five field cron expression (minute hour day-of-month month day-of-week)
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	// domStar and dowStar record if the day fields were unrestricted,
+	// see matches for the cron day matching semantics
+	domStar, dowStar bool
+}
+
+// parseCronSchedule parses a five field cron expression. Each field supports
+// `*`, single values, ranges (`1-5`), lists (`1,3,5`) and steps (`*/15`, `0-30/10`, `5/10`).
+// Day-of-week is 0-7 with both 0 and 7 being sunday
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, got %d", spec, len(fields))
+	}
+	var err error
+	s := &cronSchedule{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	for i, bounds := range []struct {
+		field    *map[int]bool
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	} {
+		*bounds.field, err = parseCronField(fields[i], bounds.min, bounds.max)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s", spec, err)
+		}
+	}
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	return s, nil
+}
+
+// parseCronField parses a single cron field into the set of values it matches
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		var err error
+		rng, step, stepped := part, 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng, stepped = part[:i], true
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+			hi, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			lo, err = strconv.Atoi(rng)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			// a single value with a step starts at the value, i.e. 5/10 is 5-max/10
+			if !stepped {
+				hi = lo
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// matches indicates if the schedule fires at the minute of t. As in cron, if both
+// day-of-month and day-of-week are restricted, a day matches if either of them matches
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+	domMatch, dowMatch := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,107 @@
+package machine
+
+import (
+	"testing"
+	"time"
+)
+
+var cronScheduleTestTable = []struct {
+	spec     string
+	time     string
+	expected bool
+}{
+	{"* * * * *", "2017-06-04T13:37:00Z", true},
+	{"30 2 * * *", "2017-06-04T02:30:00Z", true},
+	{"30 2 * * *", "2017-06-04T02:31:00Z", false},
+	{"*/15 * * * *", "2017-06-04T02:45:00Z", true},
+	{"*/15 * * * *", "2017-06-04T02:44:00Z", false},
+	{"5/10 * * * *", "2017-06-04T02:35:00Z", true},
+	{"5/10 * * * *", "2017-06-04T02:05:00Z", true},
+	{"5/10 * * * *", "2017-06-04T02:10:00Z", false},
+	{"0 22-23,0-4 * * *", "2017-06-04T03:00:00Z", true},
+	{"0 22-23,0-4 * * *", "2017-06-04T12:00:00Z", false},
+	// 2017-06-04 is a sunday
+	{"0 2 * * 0", "2017-06-04T02:00:00Z", true},
+	{"0 2 * * 7", "2017-06-04T02:00:00Z", true},
+	{"0 2 * * 1-5", "2017-06-04T02:00:00Z", false},
+	// restricted day-of-month and day-of-week match if either matches
+	{"0 2 1 * 0", "2017-06-04T02:00:00Z", true},
+	{"0 2 1 * 1", "2017-06-04T02:00:00Z", false},
+}
+
+func TestCronSchedule_matches(t *testing.T) {
+	for _, tt := range cronScheduleTestTable {
+		s, err := parseCronSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %s", tt.spec, err)
+		}
+		ts, _ := time.Parse(time.RFC3339, tt.time)
+		if s.matches(ts) != tt.expected {
+			t.Errorf("expected %q to match %s to be %t", tt.spec, tt.time, tt.expected)
+		}
+	}
+}
+
+func TestParseCronSchedule(t *testing.T) {
+	for _, spec := range []string{"* * * *", "60 * * * *", "* 5-2 * * *", "*/0 * * * *", "60/5 * * * *", "a * * * *"} {
+		_, err := parseCronSchedule(spec)
+		if err == nil {
+			t.Errorf("parsing %q should fail", spec)
+		}
+	}
+}
+
+var maintenanceWindowTestTable = []struct {
+	config   MaintenanceWindowConfig
+	time     string
+	expected bool
+}{
+	{
+		MaintenanceWindowConfig{Name: "patchday", Schedule: "0 2 * * 0", Duration: "2h"},
+		"2017-06-04T03:59:00Z",
+		true,
+	},
+	{
+		MaintenanceWindowConfig{Name: "patchday", Schedule: "0 2 * * 0", Duration: "2h"},
+		"2017-06-04T04:00:00Z",
+		false,
+	},
+	{
+		MaintenanceWindowConfig{Name: "migration", Start: "2017-06-04T00:00:00Z", End: "2017-06-05T00:00:00Z"},
+		"2017-06-04T12:00:00Z",
+		true,
+	},
+	{
+		MaintenanceWindowConfig{Name: "migration", Start: "2017-06-04T00:00:00Z", End: "2017-06-05T00:00:00Z"},
+		"2017-06-05T00:00:00Z",
+		false,
+	},
+}
+
+func TestMaintenanceWindow_active(t *testing.T) {
+	for _, tt := range maintenanceWindowTestTable {
+		w, err := newMaintenanceWindow(tt.config)
+		if err != nil {
+			t.Fatalf("failed to create maintenance window from %v: %s", tt.config, err)
+		}
+		ts, _ := time.Parse(time.RFC3339, tt.time)
+		if w.active(ts) != tt.expected {
+			t.Errorf("expected window %v to be active at %s: %t", tt.config, tt.time, tt.expected)
+		}
+	}
+}
+
+func TestNewMaintenanceWindow(t *testing.T) {
+	for _, cfg := range []MaintenanceWindowConfig{
+		{Name: "no schedule"},
+		{Name: "no duration", Schedule: "* * * * *"},
+		{Name: "both", Schedule: "* * * * *", Duration: "1h", Start: "2017-06-04T00:00:00Z"},
+		{Name: "reversed", Start: "2017-06-05T00:00:00Z", End: "2017-06-04T00:00:00Z"},
+		{Name: "mode", Schedule: "* * * * *", Duration: "1h", Mode: "ignore"},
+	} {
+		_, err := newMaintenanceWindow(cfg)
+		if err == nil {
+			t.Errorf("maintenance window %q should fail to parse", cfg.Name)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package machine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zwopir/eventhandler/filter"
+)
+
+// Counters represents the message counters of a coordinator
+type Counters struct {
+	// Received is the number of messages received from nats
+	Received int64 `json:"received"`
+	// Matched is the number of messages that passed the filters
+	Matched int64 `json:"matched"`
+	// Filtered is the number of messages that didn't pass the filters
+	Filtered int64 `json:"filtered"`
+	// Discarded is the number of matching messages that weren't dispatched because
+	// of a pause, a maintenance window, the blackout or the dispatch limit
+	Discarded int64 `json:"discarded"`
+	// Dispatched is the number of messages passed to the action
+	Dispatched int64 `json:"dispatched"`
+	// Failed is the number of dispatched messages whose action failed
+	Failed int64 `json:"failed"`
+	// Errors is the number of messages the filters failed to evaluate
+	Errors int64 `json:"errors"`
+	// Rejected is the number of messages each filter rejected, keyed by filter name. A message
+	// is rejected by the first filter that doesn't match it
+	Rejected map[string]int64 `json:"rejected,omitempty"`
+}
+
+// copy returns a copy of the counters that doesn't share the Rejected map
+func (c Counters) copy() Counters {
+	if c.Rejected == nil {
+		return c
+	}
+	rejected := make(map[string]int64, len(c.Rejected))
+	for name, n := range c.Rejected {
+		rejected[name] = n
+	}
+	c.Rejected = rejected
+	return c
+}
+
+// MessageTrace represents the filter evaluation of a received message
+type MessageTrace struct {
+	CorrelationID string       `json:"correlation_id"`
+	Subject       string       `json:"subject"`
+	Received      time.Time    `json:"received"`
+	Matched       bool         `json:"matched"`
+	Filters       filter.Trace `json:"filters"`
+}
+
+// dispatchState holds the mutable dispatch state of a coordinator.
+// It is shared between the copies of a Coordinator and safe for concurrent use
+type dispatchState struct {
+	mu sync.Mutex
+	// the start time of the coordinator
+	started time.Time
+	// the time of the last successful message dispatch
+	lastDispatched time.Time
+	// number of successful dispatches, checked against the dispatch limit
+	dispatches int64
+	// a paused coordinator discards all messages
+	paused   bool
+	counters Counters
+	// the filter trace of the last traced message
+	lastTrace *MessageTrace
+	// tracing traces every message, traceNext only the next received message
+	tracing   bool
+	traceNext bool
+}
+
+// newDispatchState returns a new dispatchState
+func newDispatchState() *dispatchState {
+	return &dispatchState{
+		started: time.Now(),
+	}
+}
+
+// update calls f with the locked state
+func (s *dispatchState) update(f func(s *dispatchState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s)
+}
+
+// dispatched records a dispatch at t
+func (s *dispatchState) dispatched(t time.Time) {
+	s.update(func(s *dispatchState) {
+		s.lastDispatched = t
+		s.dispatches += 1
+		s.counters.Dispatched += 1
+	})
+}
+
+// blackoutUntil returns the end of the blackout that follows the last dispatch
+func (s *dispatchState) blackoutUntil(blackout time.Duration) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastDispatched.Add(blackout)
+}
+
+// isPaused indicates if dispatching is paused
+func (s *dispatchState) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// dispatchCount returns the number of dispatches checked against the dispatch limit
+func (s *dispatchState) dispatchCount() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dispatches
+}
+
+// snapshot returns a copy of the counters and the start time
+func (s *dispatchState) snapshot() (Counters, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters.copy(), s.started
+}
+
+// traceMessage indicates if the received message is traced. It consumes a pending trace request
+func (s *dispatchState) traceMessage() bool {
+	traced := false
+	s.update(func(s *dispatchState) {
+		traced = s.tracing || s.traceNext
+		s.traceNext = false
+	})
+	return traced
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Message represents a received envelope with a decoded payload
+type Message struct {
+	// Subject is the nats subject the envelope was received on
+	Subject       string
+	Sender        string
+	Recipient     string
+	CorrelationID string
+	// ParentCorrelationID is the correlation ID of the message a republished message originates from
+	ParentCorrelationID string
+	// Payload is the json decoded envelope payload
+	Payload interface{}
+	// ExactPayload is the payload with numbers decoded as json.Number. Filters compare it,
+	// templates are executed with Payload
+	ExactPayload interface{}
+	// Envelope is the received envelope
+	Envelope Envelope
+	// Received is the time the message was decoded
+	Received time.Time
+	// Created is the time the envelope was published at, zero if the publisher didn't set it
+	Created time.Time
+	// Vars are additional template values set while the message is handled,
+	// i.e. the results of previous chain steps
+	Vars map[string]interface{}
+}
+
+// NewMessage decodes the envelope e into a Message
+func NewMessage(e Envelope) (*Message, error) {
+	payload, err := DecodePayload(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %s", err)
+	}
+	exactPayload, err := DecodeExactPayload(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %s", err)
+	}
+	m := &Message{
+		Sender:              string(e.Sender),
+		Recipient:           string(e.Recipient),
+		CorrelationID:       CorrelationIDString(e.CorrelationId),
+		ParentCorrelationID: CorrelationIDString(e.ParentCorrelationId),
+		Payload:             payload,
+		ExactPayload:        exactPayload,
+		Envelope:            e,
+		Received:            time.Now(),
+	}
+	if e.CreatedAt != 0 {
+		m.Created = time.Unix(0, e.CreatedAt)
+	}
+	return m, nil
+}
+
+// DecodePayload decodes a json payload like json.Unmarshal, numbers are decoded as float64
+func DecodePayload(payload []byte) (interface{}, error) {
+	return decodePayload(payload, false)
+}
+
+// DecodeExactPayload decodes a json payload with numbers as json.Number, so that
+// integers beyond the precision of a float64 keep their value
+func DecodeExactPayload(payload []byte) (interface{}, error) {
+	return decodePayload(payload, true)
+}
+
+func decodePayload(payload []byte, useNumber bool) (interface{}, error) {
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	if useNumber {
+		decoder.UseNumber()
+	}
+	err := decoder.Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid data after top-level value")
+	}
+	return data, nil
+}
+
+// Metadata returns the envelope metadata of the message as map. The creation time is
+// formatted as RFC3339, it is empty if unknown
+func (m *Message) Metadata() map[string]string {
+	created := ""
+	if !m.Created.IsZero() {
+		created = m.Created.Format(time.RFC3339Nano)
+	}
+	return map[string]string{
+		"subject":               m.Subject,
+		"sender":                m.Sender,
+		"recipient":             m.Recipient,
+		"correlation_id":        m.CorrelationID,
+		"parent_correlation_id": m.ParentCorrelationID,
+		"created_at":            created,
+	}
+}
+
+// TemplatePayload returns the payload the templates of an action are executed with.
+// If the payload is a json object, the vars are added to its keys. Other payloads are
+// wrapped with the vars in an object as "payload"
+func (m *Message) TemplatePayload() interface{} {
+	if len(m.Vars) == 0 {
+		return m.Payload
+	}
+	ret := map[string]interface{}{}
+	if payload, ok := m.Payload.(map[string]interface{}); ok {
+		for k, v := range payload {
+			ret[k] = v
+		}
+	} else {
+		ret["payload"] = m.Payload
+	}
+	for k, v := range m.Vars {
+		ret[k] = v
+	}
+	return ret
+}
+
+// CorrelationIDString formats a correlation ID. Correlation IDs set by publish are uuids,
+// other IDs are returned as is
+func CorrelationIDString(id []byte) string {
+	u, err := uuid.FromBytes(id)
+	if err != nil {
+		return string(id)
+	}
+	return u.String()
+}
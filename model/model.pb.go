@@ -29,11 +29,13 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type Envelope struct {
-	Sender        []byte `protobuf:"bytes,1,opt,name=sender,proto3" json:"sender,omitempty"`
-	Recipient     []byte `protobuf:"bytes,2,opt,name=recipient,proto3" json:"recipient,omitempty"`
-	Payload       []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
-	Signature     []byte `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
-	CorrelationId []byte `protobuf:"bytes,5,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	Sender              []byte `protobuf:"bytes,1,opt,name=sender,proto3" json:"sender,omitempty"`
+	Recipient           []byte `protobuf:"bytes,2,opt,name=recipient,proto3" json:"recipient,omitempty"`
+	Payload             []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Signature           []byte `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	CorrelationId       []byte `protobuf:"bytes,5,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	ParentCorrelationId []byte `protobuf:"bytes,6,opt,name=parent_correlation_id,json=parentCorrelationId,proto3" json:"parent_correlation_id,omitempty"`
+	CreatedAt           int64  `protobuf:"varint,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
 }
 
 func (m *Envelope) Reset()                    { *m = Envelope{} }
@@ -76,6 +78,20 @@ func (m *Envelope) GetCorrelationId() []byte {
 	return nil
 }
 
+func (m *Envelope) GetParentCorrelationId() []byte {
+	if m != nil {
+		return m.ParentCorrelationId
+	}
+	return nil
+}
+
+func (m *Envelope) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Envelope)(nil), "model.Envelope")
 }
@@ -83,15 +99,18 @@ func init() {
 func init() { proto.RegisterFile("model.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 157 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0xce, 0xcd, 0x4f, 0x49,
-	0xcd, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x05, 0x73, 0x94, 0xe6, 0x33, 0x72, 0x71,
-	0xb8, 0xe6, 0x95, 0xa5, 0xe6, 0xe4, 0x17, 0xa4, 0x0a, 0x89, 0x71, 0xb1, 0x15, 0xa7, 0xe6, 0xa5,
-	0xa4, 0x16, 0x49, 0x30, 0x2a, 0x30, 0x6a, 0xf0, 0x04, 0x41, 0x79, 0x42, 0x32, 0x5c, 0x9c, 0x45,
-	0xa9, 0xc9, 0x99, 0x05, 0x99, 0xa9, 0x79, 0x25, 0x12, 0x4c, 0x60, 0x29, 0x84, 0x80, 0x90, 0x04,
-	0x17, 0x7b, 0x41, 0x62, 0x65, 0x4e, 0x7e, 0x62, 0x8a, 0x04, 0x33, 0x58, 0x0e, 0xc6, 0x05, 0xe9,
-	0x2b, 0xce, 0x4c, 0xcf, 0x4b, 0x2c, 0x29, 0x2d, 0x4a, 0x95, 0x60, 0x81, 0xe8, 0x83, 0x0b, 0x08,
-	0xa9, 0x72, 0xf1, 0x25, 0xe7, 0x17, 0x15, 0xa5, 0xe6, 0x24, 0x96, 0x64, 0xe6, 0xe7, 0xc5, 0x67,
-	0xa6, 0x48, 0xb0, 0x82, 0x95, 0xf0, 0x22, 0x89, 0x7a, 0xa6, 0x24, 0xb1, 0x81, 0xdd, 0x6b, 0x0c,
-	0x08, 0x00, 0x00, 0xff, 0xff, 0x47, 0x85, 0x35, 0x26, 0xbe, 0x00, 0x00, 0x00,
+	// 200 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x90, 0xbd, 0x6a, 0xc3, 0x30,
+	0x14, 0x85, 0x51, 0x5d, 0xdb, 0xf5, 0xed, 0xcf, 0xa0, 0xd2, 0xa2, 0xa1, 0x05, 0x53, 0x28, 0x78,
+	0xea, 0xd0, 0x3e, 0x41, 0x29, 0x1d, 0xb2, 0xfa, 0x05, 0x8c, 0x62, 0x5d, 0x82, 0x40, 0x91, 0xc4,
+	0xf5, 0x4d, 0x20, 0xaf, 0x9d, 0x27, 0x08, 0x91, 0x9d, 0xdf, 0xf1, 0x7c, 0xe7, 0x7c, 0xcb, 0x81,
+	0xfb, 0x65, 0x30, 0xe8, 0xbe, 0x22, 0x05, 0x0e, 0x32, 0x4f, 0xe1, 0x63, 0x2b, 0xe0, 0xee, 0xdf,
+	0xaf, 0xd1, 0x85, 0x88, 0xf2, 0x15, 0x8a, 0x01, 0xbd, 0x41, 0x52, 0xa2, 0x16, 0xcd, 0x43, 0x3b,
+	0x25, 0xf9, 0x06, 0x15, 0x61, 0x6f, 0xa3, 0x45, 0xcf, 0xea, 0x26, 0x55, 0x27, 0x20, 0x15, 0x94,
+	0x51, 0x6f, 0x5c, 0xd0, 0x46, 0x65, 0xa9, 0x3b, 0xc4, 0xbd, 0x37, 0xd8, 0x85, 0xd7, 0xbc, 0x22,
+	0x54, 0xb7, 0xa3, 0x77, 0x04, 0xf2, 0x13, 0x9e, 0xfa, 0x40, 0x84, 0x4e, 0xb3, 0x0d, 0xbe, 0xb3,
+	0x46, 0xe5, 0x69, 0xf2, 0x78, 0x46, 0x67, 0x46, 0x7e, 0xc3, 0x4b, 0xd4, 0x84, 0x9e, 0xbb, 0xab,
+	0x75, 0x91, 0xd6, 0xcf, 0x63, 0xf9, 0x77, 0xe1, 0xbc, 0x03, 0xf4, 0x84, 0x9a, 0xd1, 0x74, 0x9a,
+	0x55, 0x59, 0x8b, 0x26, 0x6b, 0xab, 0x89, 0xfc, 0xf2, 0xbc, 0x48, 0x17, 0xfc, 0xec, 0x06, 0x00,
+	0x0d, 0x32, 0x75, 0x02, 0x11, 0x01, 0x00, 0x00,
 }
@@ -0,0 +1,256 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/zwopir/eventhandler/templates"
+)
+
+// HTTPRunner represents a runner that sends a http request per message.
+// Method, URL, headers and body are rendered with the keys of the payload and the
+// envelope metadata as .envelope, like the arguments of a PipeRunner
+type HTTPRunner struct {
+	Client          *http.Client
+	MethodTemplate  *template.Template
+	URLTemplate     *template.Template
+	HeaderTemplates map[string]*template.Template
+	BodyTemplate    *template.Template
+	// Retries is the number of retries after a 5xx response or a transport error
+	Retries int
+	// RetryWait is the wait before the first retry, it doubles with every retry
+	RetryWait time.Duration
+	// SuccessCodes are the status codes that indicate success. If empty, all 2xx codes do
+	SuccessCodes []int
+}
+
+// HTTPStatusError is returned if the response status code doesn't indicate success
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+// Error implements the error interface
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("request failed with status %s", e.Status)
+}
+
+// NewHTTPRunner creates a new HTTPRunner. An empty method defaults to POST
+func NewHTTPRunner(client *http.Client, method, url string, headers map[string]string, body string) (*HTTPRunner, error) {
+	var err error
+	if method == "" {
+		method = http.MethodPost
+	}
+	if url == "" {
+		return nil, errors.New("mandatory http url is missing")
+	}
+	hr := &HTTPRunner{
+		Client:          client,
+		HeaderTemplates: map[string]*template.Template{},
+	}
+	for _, t := range []struct {
+		tmpl **template.Template
+		name string
+		text string
+	}{
+		{&hr.MethodTemplate, "method", method},
+		{&hr.URLTemplate, "url", url},
+		{&hr.BodyTemplate, "body", body},
+	} {
+		*t.tmpl, err = templates.New(t.name).Parse(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse http %s template: %s", t.name, err)
+		}
+	}
+	for name, value := range headers {
+		hr.HeaderTemplates[name], err = templates.New(name).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template of http header %s: %s", name, err)
+		}
+	}
+	return hr, nil
+}
+
+// NewTLSConfig returns a tls.Config that trusts the CAs in caFile in addition to the system
+// roots and authenticates with the client certificate in certFile and keyFile. All files are optional
+func NewTLSConfig(caFile, certFile, keyFile, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// request is a rendered http request
+type request struct {
+	method  string
+	url     string
+	headers [][2]string
+	body    []byte
+}
+
+// render renders the request templates
+func (hr *HTTPRunner) render(data interface{}, meta Metadata) (request, error) {
+	var (
+		req request
+		err error
+	)
+	tmplData := TemplateData(data, meta)
+	req.method, err = renderValue(hr.MethodTemplate, tmplData)
+	if err != nil {
+		return req, err
+	}
+	req.method = strings.ToUpper(strings.TrimSpace(req.method))
+	req.url, err = renderValue(hr.URLTemplate, tmplData)
+	if err != nil {
+		return req, err
+	}
+	req.url = strings.TrimSpace(req.url)
+	names := []string{}
+	for name := range hr.HeaderTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := renderValue(hr.HeaderTemplates[name], tmplData)
+		if err != nil {
+			return req, err
+		}
+		req.headers = append(req.headers, [2]string{name, value})
+	}
+	body, err := renderValue(hr.BodyTemplate, tmplData)
+	if err != nil {
+		return req, err
+	}
+	req.body = []byte(body)
+	return req, nil
+}
+
+// Render implements the Renderer interface. It renders the request
+func (hr *HTTPRunner) Render(data interface{}, meta Metadata) (*Rendering, error) {
+	req, err := hr.render(data, meta)
+	if err != nil {
+		return nil, err
+	}
+	r := &Rendering{
+		Method: req.method,
+		URL:    req.url,
+		Body:   string(req.body),
+	}
+	for _, h := range req.headers {
+		r.Headers = append(r.Headers, h[0]+": "+h[1])
+	}
+	return r, nil
+}
+
+// success indicates if code is a success status code
+func (hr *HTTPRunner) success(code int) bool {
+	if len(hr.SuccessCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range hr.SuccessCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Run implements the Runner interface. It renders and sends the request and writes the
+// response body of the last attempt to stdout. Requests are retried on transport errors
+// and 5xx responses until ctx is canceled
+func (hr *HTTPRunner) Run(ctx context.Context, data interface{}, meta Metadata, stdout, stderr io.Writer) error {
+	req, err := hr.render(data, meta)
+	if err != nil {
+		return err
+	}
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	wait := hr.RetryWait
+	for attempt := 0; ; attempt++ {
+		var (
+			body      []byte
+			retryable bool
+		)
+		body, retryable, err = hr.send(ctx, req)
+		if err == nil || !retryable || attempt >= hr.Retries {
+			stdout.Write(body)
+			return err
+		}
+		log.Warnf("%s %s failed (attempt %d of %d), retrying in %s: %s", req.method, req.url, attempt+1, hr.Retries+1, wait, err)
+		if stderr != nil {
+			fmt.Fprintf(stderr, "attempt %d: %s\n", attempt+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("retry canceled: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// send sends a single request and returns the response body. It returns if the request
+// may be retried on error
+func (hr *HTTPRunner) send(ctx context.Context, req request) ([]byte, bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, req.url, bytes.NewReader(req.body))
+	if err != nil {
+		return nil, false, err
+	}
+	for _, h := range req.headers {
+		// net/http ignores a Host header, the host is set on the request
+		if http.CanonicalHeaderKey(h[0]) == "Host" {
+			httpReq.Host = h[1]
+			continue
+		}
+		httpReq.Header.Set(h[0], h[1])
+	}
+	log.Debugf("sending %s %s", req.method, req.url)
+	resp, err := hr.Client.Do(httpReq)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return body, true, fmt.Errorf("failed to read response body: %s", err)
+	}
+	if !hr.success(resp.StatusCode) {
+		return body, resp.StatusCode >= 500, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return body, false, nil
+}
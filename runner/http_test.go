@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var httpRunnerTestTable = []struct {
+	statuses     []int
+	retries      int
+	successCodes []int
+	attempts     int
+	fail         bool
+}{
+	{[]int{200}, 0, nil, 1, false},
+	{[]int{500, 502, 200}, 2, nil, 3, false},
+	{[]int{500, 500, 500}, 1, nil, 2, true},
+	// client errors are not retried
+	{[]int{404, 200}, 3, nil, 1, true},
+	{[]int{404}, 0, []int{200, 404}, 1, false},
+	{[]int{201}, 0, []int{200}, 1, true},
+}
+
+func TestHTTPRunner_Run(t *testing.T) {
+	for _, tt := range httpRunnerTestTable {
+		var (
+			attempts int
+			requests []string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, r.Host+" "+r.Method+" "+r.URL.String()+" "+r.Header.Get("X-Check")+" "+string(body))
+			w.WriteHeader(tt.statuses[attempts])
+			attempts++
+			fmt.Fprintf(w, "response %d", attempts)
+		}))
+		hr, err := NewHTTPRunner(
+			server.Client(),
+			"put",
+			server.URL+`/{{ .envelope.sender }}?key={{ .key | urlquery }}`,
+			map[string]string{"X-Check": `{{ upper .key }}`, "host": "alerts.example.com"},
+			`{{ toJson . }}`,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hr.Retries = tt.retries
+		hr.SuccessCodes = tt.successCodes
+		stdout := &bytes.Buffer{}
+		err = hr.Run(context.Background(), map[string]interface{}{"key": "a b"}, Metadata{"sender": "sender"}, stdout, ioutil.Discard)
+		server.Close()
+		if (err != nil) != tt.fail {
+			t.Errorf("statuses %v: expected failure to be %t, got %v", tt.statuses, tt.fail, err)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("statuses %v: expected %d attempts, got %d", tt.statuses, tt.attempts, attempts)
+		}
+		expected := `alerts.example.com PUT /sender?key=a+b A B {"envelope":{"sender":"sender"},"key":"a b"}`
+		for _, r := range requests {
+			if r != expected {
+				t.Errorf("expected request %q, got %q", expected, r)
+			}
+		}
+		// only the response of the last attempt is captured
+		if body := fmt.Sprintf("response %d", attempts); stdout.String() != body {
+			t.Errorf("statuses %v: expected %q on stdout, got %q", tt.statuses, body, stdout.String())
+		}
+	}
+}
+
+func TestNewHTTPRunner(t *testing.T) {
+	_, err := NewHTTPRunner(http.DefaultClient, "", "", nil, "")
+	if err == nil {
+		t.Error("expected a missing url to fail")
+	}
+	_, err = NewHTTPRunner(http.DefaultClient, "", "http://localhost/{{ .key", nil, "")
+	if err == nil {
+		t.Error("expected an invalid url template to fail")
+	}
+}
+
+func TestHTTPRunner_Run_cancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	hr, err := NewHTTPRunner(server.Client(), "", server.URL, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hr.Retries = 3
+	hr.RetryWait = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err = hr.Run(ctx, nil, nil, ioutil.Discard, ioutil.Discard)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the retries to be canceled, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("canceling the retries took %s", time.Since(start))
+	}
+}
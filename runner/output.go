@@ -0,0 +1,141 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/prometheus/common/log"
+)
+
+// CappedBuffer is an io.Writer that retains at most head bytes from the beginning
+// and tail bytes from the end of the written data. The bytes in between are discarded
+// and replaced by a truncation marker in Bytes
+type CappedBuffer struct {
+	head, tail int
+	headBuf    []byte
+	// tailBuf is a ring buffer of size tail, tailPos is the position of the next write
+	tailBuf  []byte
+	tailPos  int
+	tailFull bool
+	// number of bytes written after the head was filled
+	tailWritten int64
+}
+
+// NewCappedBuffer returns a CappedBuffer that retains limit bytes, half of them from
+// the beginning and half of them from the end of the output. A limit of 0 retains nothing
+func NewCappedBuffer(limit int) *CappedBuffer {
+	head := limit / 2
+	return &CappedBuffer{
+		head:    head,
+		tail:    limit - head,
+		tailBuf: make([]byte, limit-head),
+	}
+}
+
+// Write implements the io.Writer interface. It never fails
+func (b *CappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.head - len(b.headBuf); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.headBuf = append(b.headBuf, p[:room]...)
+		p = p[room:]
+	}
+	b.tailWritten += int64(len(p))
+	if b.tail == 0 {
+		return n, nil
+	}
+	if len(p) >= b.tail {
+		copy(b.tailBuf, p[len(p)-b.tail:])
+		b.tailPos = 0
+		b.tailFull = true
+		return n, nil
+	}
+	for len(p) > 0 {
+		c := copy(b.tailBuf[b.tailPos:], p)
+		b.tailPos += c
+		p = p[c:]
+		if b.tailPos == b.tail {
+			b.tailPos = 0
+			b.tailFull = true
+		}
+	}
+	return n, nil
+}
+
+// Truncated returns the number of discarded bytes
+func (b *CappedBuffer) Truncated() int64 {
+	if b.tailWritten > int64(b.tail) {
+		return b.tailWritten - int64(b.tail)
+	}
+	return 0
+}
+
+// Bytes returns the retained output. If bytes were discarded, a truncation marker
+// is inserted between the head and the tail
+func (b *CappedBuffer) Bytes() []byte {
+	ret := new(bytes.Buffer)
+	ret.Write(b.headBuf)
+	if truncated := b.Truncated(); truncated > 0 {
+		fmt.Fprintf(ret, "\n[... %d bytes truncated ...]\n", truncated)
+	}
+	if b.tailFull {
+		ret.Write(b.tailBuf[b.tailPos:])
+	}
+	ret.Write(b.tailBuf[:b.tailPos])
+	return ret.Bytes()
+}
+
+// String returns the retained output as string, see Bytes
+func (b *CappedBuffer) String() string {
+	return string(b.Bytes())
+}
+
+// maxLogLineLength is the length after which a line without newline is logged
+const maxLogLineLength = 4096
+
+// LineLogger is an io.Writer that logs every written line prefixed with a correlation ID
+// and the stream name. Lines longer than 4096 bytes are split
+type LineLogger struct {
+	prefix string
+	buf    []byte
+}
+
+// NewLineLogger returns a LineLogger that prefixes lines with correlationID and stream
+func NewLineLogger(correlationID, stream string) *LineLogger {
+	return &LineLogger{
+		prefix: fmt.Sprintf("[%s] %s: ", correlationID, stream),
+	}
+}
+
+// Write implements the io.Writer interface
+func (l *LineLogger) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.log(l.buf[:i])
+		l.buf = l.buf[i+1:]
+	}
+	for len(l.buf) >= maxLogLineLength {
+		l.log(l.buf[:maxLogLineLength])
+		l.buf = l.buf[maxLogLineLength:]
+	}
+	return len(p), nil
+}
+
+// Flush logs a pending incomplete line
+func (l *LineLogger) Flush() {
+	if len(l.buf) > 0 {
+		l.log(l.buf)
+		l.buf = nil
+	}
+}
+
+// log logs a single line
+func (l *LineLogger) log(line []byte) {
+	log.Info(l.prefix + string(bytes.TrimRight(line, "\r")))
+}
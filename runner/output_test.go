@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+var cappedBufferTestTable = []struct {
+	limit     int
+	writes    []string
+	expected  string
+	truncated int64
+}{
+	{10, []string{"short"}, "short", 0},
+	{10, []string{"exactly10!"}, "exactly10!", 0},
+	{10, []string{"0123456789abcdef"}, "01234\n[... 6 bytes truncated ...]\nbcdef", 6},
+	{10, []string{"012", "3456", "789a", "bcd", "ef"}, "01234\n[... 6 bytes truncated ...]\nbcdef", 6},
+	{0, []string{"discarded"}, "\n[... 9 bytes truncated ...]\n", 9},
+}
+
+func TestCappedBuffer(t *testing.T) {
+	for _, tt := range cappedBufferTestTable {
+		b := NewCappedBuffer(tt.limit)
+		for _, w := range tt.writes {
+			n, err := b.Write([]byte(w))
+			if err != nil || n != len(w) {
+				t.Fatalf("write of %q returned %d, %v", w, n, err)
+			}
+		}
+		if b.String() != tt.expected {
+			t.Errorf("expected %q after writing %q, got %q", tt.expected, tt.writes, b.String())
+		}
+		if b.Truncated() != tt.truncated {
+			t.Errorf("expected %d truncated bytes, got %d", tt.truncated, b.Truncated())
+		}
+	}
+}
+
+func TestLineLogger(t *testing.T) {
+	l := NewLineLogger("testUUID", "stdout")
+	l.Write([]byte("first line\nsecond "))
+	if string(l.buf) != "second " {
+		t.Errorf("expected the incomplete line to be buffered, got %q", l.buf)
+	}
+	l.Write([]byte(strings.Repeat("x", 2*maxLogLineLength)))
+	if len(l.buf) >= maxLogLineLength {
+		t.Errorf("expected long lines to be split, %d bytes are buffered", len(l.buf))
+	}
+	l.Flush()
+	if len(l.buf) != 0 {
+		t.Error("expected Flush to empty the buffer")
+	}
+}
@@ -0,0 +1,139 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/prometheus/common/log"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// cgroupRoot is the mount point of the cgroup v2 hierarchy
+	cgroupRoot = "/sys/fs/cgroup"
+	// rlimitHelper is the argv[0] the eventhandler binary is re-executed with to set the
+	// resource limits of a command before executing it
+	rlimitHelper = "eventhandler-rlimit-helper"
+	// rlimitHelperExitCode is the exit code of the helper if it failed to set the limits
+	// or to execute the command
+	rlimitHelperExitCode = 126
+)
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == rlimitHelper {
+		err := runRlimitHelper(os.Args[1:])
+		fmt.Fprintf(os.Stderr, "%s: %s\n", rlimitHelper, err)
+		os.Exit(rlimitHelperExitCode)
+	}
+}
+
+// rlimitResources returns the resources and the values of the limits in r
+func rlimitResources(r Rlimits) []struct {
+	resource int
+	value    uint64
+} {
+	return []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, uint64((r.CPU + 999999999) / 1000000000)},
+		{syscall.RLIMIT_AS, r.Memory},
+		{syscall.RLIMIT_NOFILE, r.NoFile},
+		{unix.RLIMIT_NPROC, r.NProc},
+	}
+}
+
+// runRlimitHelper sets the resource limits encoded in args[0] on the current process and
+// replaces it with the command args[1], executed with the arguments args[2:]. It only
+// returns on errors
+func runRlimitHelper(args []string) error {
+	if len(args) < 3 {
+		return errors.New("missing arguments")
+	}
+	for _, limit := range strings.Split(args[0], ",") {
+		parts := strings.SplitN(limit, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid resource limit %q", limit)
+		}
+		resource, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid resource limit %q", limit)
+		}
+		value, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid resource limit %q", limit)
+		}
+		err = syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+		if err != nil {
+			return fmt.Errorf("failed to set resource limit %d: %s", resource, err)
+		}
+	}
+	return syscall.Exec(args[1], args[2:], os.Environ())
+}
+
+// restrictCommand prepares cmd to start with the resource limits and in the cgroup of proc.
+// Without cgroup v2 the command is started without the cgroup, a cgroup that is available
+// but can't be joined fails the start. The resource limits are set by re-executing the
+// eventhandler binary as helper, which executes the command only after it set the limits.
+// The returned release func must be called after the start
+func restrictCommand(cmd *exec.Cmd, proc Process) (func(), error) {
+	release := func() {}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if proc.Cgroup != "" {
+		fd, err := openCgroup(proc.Cgroup)
+		switch {
+		case err == errCgroupUnavailable:
+			log.Warnf("starting %s outside of cgroup %s: %s", cmd.Path, proc.Cgroup, err)
+		case err != nil:
+			return release, err
+		default:
+			cmd.SysProcAttr.UseCgroupFD = true
+			cmd.SysProcAttr.CgroupFD = fd
+			release = func() { syscall.Close(fd) }
+		}
+	}
+	if !proc.Rlimits.empty() {
+		if cmd.Err != nil {
+			release()
+			return func() {}, cmd.Err
+		}
+		limits := []string{}
+		for _, limit := range rlimitResources(proc.Rlimits) {
+			if limit.value != 0 {
+				limits = append(limits, fmt.Sprintf("%d=%d", limit.resource, limit.value))
+			}
+		}
+		cmd.Args = append([]string{rlimitHelper, strings.Join(limits, ","), cmd.Path}, cmd.Args...)
+		cmd.Path = "/proc/self/exe"
+	}
+	return release, nil
+}
+
+// errCgroupUnavailable is returned by openCgroup if cgroup v2 isn't mounted
+var errCgroupUnavailable = errors.New("cgroup v2 is not available")
+
+// openCgroup opens the cgroup v2 group at path relative to the cgroup v2 mount point.
+// The group is created if it doesn't exist
+func openCgroup(path string) (int, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return -1, errCgroupUnavailable
+	}
+	dir := filepath.Join(cgroupRoot, filepath.Clean("/"+path))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return -1, fmt.Errorf("failed to create cgroup: %s", err)
+	}
+	fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open cgroup: %s", err)
+	}
+	return fd, nil
+}
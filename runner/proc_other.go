@@ -0,0 +1,23 @@
+//go:build !linux
+
+package runner
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/prometheus/common/log"
+)
+
+// restrictCommand fails for commands with resource limits, they are only supported on
+// linux. Commands with a cgroup are started outside of it
+func restrictCommand(cmd *exec.Cmd, proc Process) (func(), error) {
+	release := func() {}
+	if !proc.Rlimits.empty() {
+		return release, errors.New("resource limits are only supported on linux")
+	}
+	if proc.Cgroup != "" {
+		log.Warnf("starting %s outside of cgroup %s: cgroups are only supported on linux", cmd.Path, proc.Cgroup)
+	}
+	return release, nil
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command the leader of a new process group, so that
+// the command and all its children can be signaled at once
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalProcessGroup sends sig to the process group of the started command
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// setCredential makes the command run with the user and group id of p
+func setCredential(cmd *exec.Cmd, p Process) error {
+	if p.UID == nil && p.GID == nil {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// the supplementary groups of the eventhandler process are dropped
+	credential := &syscall.Credential{
+		Uid:    uint32(os.Getuid()),
+		Gid:    uint32(os.Getgid()),
+		Groups: []uint32{},
+	}
+	if p.UID != nil {
+		credential.Uid = *p.UID
+	}
+	if p.GID != nil {
+		credential.Gid = *p.GID
+	}
+	cmd.SysProcAttr.Credential = credential
+	return nil
+}
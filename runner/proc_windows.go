@@ -0,0 +1,24 @@
+package runner
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op, process groups are not supported on windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup kills the started command. Signals and process groups are not
+// supported on windows, so sig is ignored and children are not killed
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return cmd.Process.Kill()
+}
+
+// setCredential is not supported on windows
+func setCredential(cmd *exec.Cmd, p Process) error {
+	if p.UID == nil && p.GID == nil {
+		return nil
+	}
+	return errors.New("running commands as a different user is not supported on windows")
+}
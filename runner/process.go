@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Process restricts the privileges and the resources of a command. The zero value
+// runs the command with the privileges and limits of the eventhandler process
+type Process struct {
+	// UID and GID the command runs as. If nil, the ids of the eventhandler process are kept
+	UID *uint32
+	GID *uint32
+	// Rlimits are set before the command is executed. The eventhandler binary is
+	// re-executed to set them, it must be executable by the user of the command
+	Rlimits Rlimits
+	// Cgroup is the path of a cgroup v2 group relative to the cgroup2 mount point the
+	// command is started in. The group is created if it doesn't exist. Without cgroup v2
+	// the command is started outside of the group, otherwise it isn't started if it can't
+	// be placed in the group
+	Cgroup string
+}
+
+// Rlimits represents the resource limits of a command. A zero value keeps
+// the limit inherited from the eventhandler process
+type Rlimits struct {
+	// CPU is the cpu time limit, rounded up to whole seconds (RLIMIT_CPU)
+	CPU time.Duration
+	// Memory is the address space limit in bytes (RLIMIT_AS)
+	Memory uint64
+	// NoFile is the maximum number of open files (RLIMIT_NOFILE)
+	NoFile uint64
+	// NProc is the maximum number of processes of the user (RLIMIT_NPROC)
+	NProc uint64
+}
+
+// empty indicates if no resource limit is set
+func (r Rlimits) empty() bool {
+	return r == Rlimits{}
+}
+
+// NewProcess returns a Process that runs the command as userName and groupName.
+// Names can be user and group names or numeric ids. If groupName is empty and userName
+// isn't, the primary group of the user is used
+func NewProcess(userName, groupName string, rlimits Rlimits, cgroup string) (Process, error) {
+	p := Process{
+		Rlimits: rlimits,
+		Cgroup:  cgroup,
+	}
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			u, err = user.LookupId(userName)
+		}
+		if err != nil {
+			return p, fmt.Errorf("unknown user %q", userName)
+		}
+		p.UID, err = parseID(u.Uid)
+		if err != nil {
+			return p, err
+		}
+		if groupName == "" {
+			p.GID, err = parseID(u.Gid)
+			if err != nil {
+				return p, err
+			}
+		}
+	}
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			g, err = user.LookupGroupId(groupName)
+		}
+		if err != nil {
+			return p, fmt.Errorf("unknown group %q", groupName)
+		}
+		p.GID, err = parseID(g.Gid)
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// parseID parses a numeric user or group id
+func parseID(s string) (*uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user or group id %q is not numeric", s)
+	}
+	ret := uint32(id)
+	return &ret, nil
+}
+
+// ParseSize parses a size in bytes with an optional K, M, G or T suffix (powers of 1024)
+func ParseSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	multiplier := uint64(1)
+	for i, suffix := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(strings.ToUpper(s), suffix) {
+			multiplier = 1 << (10 * uint(i+1))
+			s = s[:len(s)-1]
+			break
+		}
+	}
+	size, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size * multiplier, nil
+}
@@ -0,0 +1,111 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var parseSizeTestTable = []struct {
+	size     string
+	expected uint64
+}{
+	{"1024", 1024},
+	{"4K", 4096},
+	{"512M", 512 << 20},
+	{"2g", 2 << 30},
+}
+
+func TestParseSize(t *testing.T) {
+	for _, tt := range parseSizeTestTable {
+		size, err := ParseSize(tt.size)
+		if err != nil {
+			t.Errorf("failed to parse %q: %s", tt.size, err)
+		}
+		if size != tt.expected {
+			t.Errorf("expected %q to be %d bytes, got %d", tt.size, tt.expected, size)
+		}
+	}
+	_, err := ParseSize("12X")
+	if err == nil {
+		t.Error("parsing an invalid size should fail")
+	}
+}
+
+func TestNewProcess(t *testing.T) {
+	p, err := NewProcess("0", "", Rlimits{}, "")
+	if err != nil {
+		t.Skipf("no user with id 0: %s", err)
+	}
+	if p.UID == nil || *p.UID != 0 || p.GID == nil {
+		t.Errorf("expected uid 0 with its primary group, got %+v", p)
+	}
+	_, err = NewProcess("no-such-user-eventhandler", "", Rlimits{}, "")
+	if err == nil {
+		t.Error("expected an error for an unknown user")
+	}
+}
+
+func TestNewExecFunc2(t *testing.T) {
+	execFunc := newExecFunc(
+		"sh",
+		5*time.Second,
+		time.Second,
+		Process{Rlimits: Rlimits{NoFile: 64}},
+	)
+	b := new(bytes.Buffer)
+	err := execFunc(context.Background(), Invocation{Args: []string{"-c", "echo $0; ulimit -n"}}, new(bytes.Buffer), b, nil)
+	if err != nil {
+		t.Skipf("resource limits are not supported: %s", err)
+	}
+	if b.String() != "sh\n64\n" {
+		t.Errorf("expected sh with an open file limit of 64, got %q", b.String())
+	}
+}
+
+func TestNewExecFunc3(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the user requires root")
+	}
+	uid, gid := uint32(65534), uint32(65534)
+	execFunc := newExecFunc("id", 5*time.Second, time.Second, Process{UID: &uid, GID: &gid})
+	b := new(bytes.Buffer)
+	err := execFunc(context.Background(), Invocation{Args: []string{"-u"}}, new(bytes.Buffer), b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(b.String()) != "65534" {
+		t.Errorf("expected the command to run as uid 65534, got %q", b.String())
+	}
+}
+
+func TestNewExecFunc4(t *testing.T) {
+	execFunc := newExecFunc(
+		"sh",
+		5*time.Second,
+		time.Second,
+		Process{Rlimits: Rlimits{NoFile: 64}, Cgroup: "eventhandler-test"},
+	)
+	b := new(bytes.Buffer)
+	err := execFunc(context.Background(), Invocation{Args: []string{"-c", "echo $0; cat /proc/self/cgroup"}}, new(bytes.Buffer), b, nil)
+	if _, statErr := os.Stat("/sys/fs/cgroup/cgroup.controllers"); statErr != nil {
+		// without cgroup v2 the command runs outside of the cgroup
+		if err != nil || !strings.HasPrefix(b.String(), "sh\n") {
+			t.Errorf("expected sh to run without cgroup v2, got %q (%v)", b.String(), err)
+		}
+		return
+	}
+	if err != nil {
+		// the command must not run outside of an available cgroup it can't join
+		if b.Len() > 0 {
+			t.Errorf("expected the command not to run, got %q", b.String())
+		}
+		t.Skipf("cgroup can't be joined: %s", err)
+	}
+	if !strings.HasPrefix(b.String(), "sh\n") || !strings.Contains(b.String(), "/eventhandler-test") {
+		t.Errorf("expected sh to run in cgroup eventhandler-test, got %q", b.String())
+	}
+}
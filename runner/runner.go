@@ -3,64 +3,304 @@ package runner
 import (
 	"bytes"
 	"context"
-	"github.com/prometheus/common/log"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
 	"text/template"
 	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/zwopir/eventhandler/templates"
 )
 
+// Runner represents an action that is run per message. The data is the decoded payload,
+// the output of the action is written to stdout and stderr. A canceled ctx ends the run
+type Runner interface {
+	Run(ctx context.Context, data interface{}, meta Metadata, stdout, stderr io.Writer) error
+}
+
+// Renderer is implemented by runners that can render what they would run for a message
+// without running it
+type Renderer interface {
+	Render(data interface{}, meta Metadata) (*Rendering, error)
+}
+
+// Rendering represents the rendered templates of a runner. The fields used depend on the runner
+type Rendering struct {
+	Invocation
+	Stdin   string
+	Method  string
+	URL     string
+	Headers []string
+	Body    string
+}
+
+// Metadata represents the envelope metadata of a message (i.e. sender, recipient and correlation_id).
+// It is available as .envelope in the argument, environment and working directory templates
+type Metadata map[string]string
+
+// Invocation represents the rendered, per message parts of a command execution
+type Invocation struct {
+	// Args are the command arguments, each one is passed as a single argv entry
+	Args []string
+	// Env is appended to the environment of the eventhandler process
+	Env []string
+	// Dir is the working directory of the command. If empty, the command
+	// runs in the working directory of the eventhandler process
+	Dir string
+}
+
 // PipeRunner represents a type that defines a command via an ExecFunc.
 // Its Run method takes data as interface{} which are rendered an passed to the commands
 // stdin io.Reader
 type PipeRunner struct {
 	Exec          ExecFunc
 	StdinTemplate *template.Template
+	// ArgTemplates, EnvTemplates and WorkdirTemplate are rendered to the Invocation
+	// passed to Exec. They are executed with the keys of the payload and the envelope
+	// metadata as .envelope
+	ArgTemplates    []*template.Template
+	EnvTemplates    map[string]*template.Template
+	WorkdirTemplate *template.Template
 }
 
 // NewPipeRunner creates a new PipeRunner
-func NewPipeRunner(ctx context.Context, cmdString string, args []string, timeout time.Duration, tmpl *template.Template) *PipeRunner {
-	execFunc := newExecFunc(ctx, cmdString, args, timeout)
+func NewPipeRunner(cmdString string, args []*template.Template, timeout, grace time.Duration, proc Process, tmpl *template.Template) *PipeRunner {
+	execFunc := newExecFunc(cmdString, timeout, grace, proc)
 	return &PipeRunner{
 		Exec:          execFunc,
 		StdinTemplate: tmpl,
+		ArgTemplates:  args,
+	}
+}
+
+// ParseArgTemplates parses the command arguments into templates
+func ParseArgTemplates(args []string) ([]*template.Template, error) {
+	ret := []*template.Template{}
+	for i, arg := range args {
+		tmpl, err := templates.New(fmt.Sprintf("arg%d", i)).Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse argument template %q: %s", arg, err)
+		}
+		ret = append(ret, tmpl)
 	}
+	return ret, nil
 }
 
-// Run connects the stdout io.Writer to the command, renders the provided data
+// ParseEnvTemplates parses the values of the environment variables into templates
+func ParseEnvTemplates(env map[string]string) (map[string]*template.Template, error) {
+	ret := map[string]*template.Template{}
+	for key, value := range env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return nil, fmt.Errorf("invalid environment variable name %q", key)
+		}
+		tmpl, err := templates.New(key).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template of environment variable %s: %s", key, err)
+		}
+		ret[key] = tmpl
+	}
+	return ret, nil
+}
+
+// Run connects the stdout and stderr io.Writer to the command, renders the provided data
 // via PipeRunner.StdinTemplate and passes the result to the commands stdin
-// The command stdout is written to the stdout io.Writer
+// The command stdout is written to the stdout io.Writer, stderr to the stderr io.Writer
 //
-// stdin -> PipeRunner.StdinTemplate -> ExecFunc -> stdout
-func (pr *PipeRunner) Run(data interface{}, stdout io.Writer) error {
-	var err error
-	b := new(bytes.Buffer)
-	err = pr.StdinTemplate.Execute(b, data)
+// stdin -> PipeRunner.StdinTemplate -> ExecFunc -> stdout, stderr
+func (pr *PipeRunner) Run(ctx context.Context, data interface{}, meta Metadata, stdout, stderr io.Writer) error {
+	r, err := pr.Render(data, meta)
 	if err != nil {
 		return err
 	}
-	log.Debugf("rendered stdin template to %s", b.String())
-	err = pr.Exec(b, stdout)
-	return err
+	log.Debugf("rendered stdin template to %s", r.Stdin)
+	log.Debugf("rendered invocation to %q", r.Invocation)
+	return pr.Exec(ctx, r.Invocation, strings.NewReader(r.Stdin), stdout, stderr)
 }
 
-// ExecFunc represents an adapter between a process, a stdin io.Reader and a
-// stdout io.Writer
-type ExecFunc func(stdinReader io.Reader, stdoutWriter io.Writer) error
+// Render implements the Renderer interface. It renders the stdin and the invocation
+func (pr *PipeRunner) Render(data interface{}, meta Metadata) (*Rendering, error) {
+	b := new(bytes.Buffer)
+	err := pr.StdinTemplate.Execute(b, data)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := pr.invocation(data, meta)
+	if err != nil {
+		return nil, err
+	}
+	return &Rendering{Stdin: b.String(), Invocation: inv}, nil
+}
 
-// newExecFunc returns an ExecFunc with the Command set to os/exec.CommandContext
+// invocation renders the argument, environment and working directory templates
+func (pr *PipeRunner) invocation(data interface{}, meta Metadata) (Invocation, error) {
+	var (
+		inv Invocation
+		err error
+	)
+	tmplData := TemplateData(data, meta)
+	for _, tmpl := range pr.ArgTemplates {
+		arg, err := renderValue(tmpl, tmplData)
+		if err != nil {
+			return inv, err
+		}
+		inv.Args = append(inv.Args, arg)
+	}
+	keys := []string{}
+	for key := range pr.EnvTemplates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := renderValue(pr.EnvTemplates[key], tmplData)
+		if err != nil {
+			return inv, err
+		}
+		inv.Env = append(inv.Env, key+"="+value)
+	}
+	if pr.WorkdirTemplate != nil {
+		inv.Dir, err = renderValue(pr.WorkdirTemplate, tmplData)
+		if err != nil {
+			return inv, err
+		}
+	}
+	return inv, nil
+}
+
+// TemplateData returns the data the invocation templates are executed with,
+// the keys of a json object payload and the envelope metadata as "envelope"
+func TemplateData(data interface{}, meta Metadata) map[string]interface{} {
+	ret := map[string]interface{}{}
+	if payload, ok := data.(map[string]interface{}); ok {
+		for k, v := range payload {
+			ret[k] = v
+		}
+	}
+	ret["envelope"] = meta
+	return ret
+}
+
+// renderValue executes tmpl with data. The result is used verbatim as a single argv entry,
+// environment value or path and must not contain NUL bytes
+func renderValue(tmpl *template.Template, data interface{}) (string, error) {
+	b := new(bytes.Buffer)
+	err := tmpl.Execute(b, data)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(b.Bytes(), 0) >= 0 {
+		return "", fmt.Errorf("template %s rendered to a value containing a NUL byte", tmpl.Name())
+	}
+	return b.String(), nil
+}
+
+// ExecFunc represents an adapter between a process, a stdin io.Reader and
+// stdout and stderr io.Writer. The process is ended if ctx is canceled
+type ExecFunc func(ctx context.Context, inv Invocation, stdinReader io.Reader, stdoutWriter, stderrWriter io.Writer) error
+
+// TimeoutError is returned by an ExecFunc if the command exceeded its timeout
+type TimeoutError struct {
+	Timeout time.Duration
+	// Signal is the signal that ended the command, either SIGTERM or SIGKILL
+	// if the command didn't terminate within the grace period
+	Signal syscall.Signal
+}
+
+// Error implements the error interface
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("command exceeded its timeout of %s and was ended by %s", e.Timeout, e.Signal)
+}
+
+// newExecFunc returns an ExecFunc that runs the command in its own process group.
+// The command is executed directly, arguments are never interpreted by a shell.
+// If the command exceeds the timeout or the context of the run is canceled, the whole
+// process group receives a SIGTERM and, if it is still running after the grace period, a SIGKILL.
+// The command runs with the credentials, resource limits and cgroup of proc
 func newExecFunc(
-	ctx context.Context,
 	cmdString string,
-	args []string,
 	timeout time.Duration,
+	grace time.Duration,
+	proc Process,
 ) ExecFunc {
-	return func(r io.Reader, w io.Writer) error {
-		ctx, done := context.WithTimeout(ctx, timeout)
+	return func(runCtx context.Context, inv Invocation, r io.Reader, w, ew io.Writer) error {
+		ctx, done := context.WithTimeout(runCtx, timeout)
 		defer done()
-		cmd := exec.CommandContext(ctx, cmdString, args...)
+		cmd := exec.CommandContext(ctx, cmdString, inv.Args...)
+		if len(inv.Env) > 0 {
+			cmd.Env = append(os.Environ(), inv.Env...)
+		}
+		cmd.Dir = inv.Dir
 		cmd.Stdin = r
 		cmd.Stdout = w
-		return cmd.Run()
+		cmd.Stderr = ew
+		setProcessGroup(cmd)
+		// on timeout or cancelation, the process group is terminated instead of killing the command
+		cmd.Cancel = func() error {
+			if runCtx.Err() != nil {
+				log.Warnf("%s was canceled, sending SIGTERM to its process group", cmdString)
+			} else {
+				log.Warnf("%s exceeded its timeout of %s, sending SIGTERM to its process group", cmdString, timeout)
+			}
+			err := signalProcessGroup(cmd, syscall.SIGTERM)
+			if err != nil {
+				log.Errorf("failed to send SIGTERM to the process group of %s: %s", cmdString, err)
+			}
+			return err
+		}
+		err := setCredential(cmd, proc)
+		if err != nil {
+			return err
+		}
+		release, err := restrictCommand(cmd, proc)
+		if err != nil {
+			return err
+		}
+		err = cmd.Start()
+		release()
+		if err != nil {
+			return err
+		}
+
+		// Wait returns after the command exited and all holders of its stdout and stderr closed them,
+		// i.e. a background child that keeps running keeps Wait from returning
+		waitCh := make(chan error, 1)
+		go func() {
+			waitCh <- cmd.Wait()
+		}()
+		select {
+		case err := <-waitCh:
+			if ctx.Err() == nil {
+				return err
+			}
+			return endedError(runCtx, timeout, syscall.SIGTERM)
+		case <-ctx.Done():
+		}
+
+		select {
+		case <-waitCh:
+			return endedError(runCtx, timeout, syscall.SIGTERM)
+		case <-time.After(grace):
+		}
+
+		log.Warnf("%s didn't terminate within the grace period of %s, sending SIGKILL to its process group", cmdString, grace)
+		err = signalProcessGroup(cmd, syscall.SIGKILL)
+		if err != nil {
+			log.Errorf("failed to send SIGKILL to the process group of %s: %s", cmdString, err)
+		}
+		<-waitCh
+		return endedError(runCtx, timeout, syscall.SIGKILL)
+	}
+}
+
+// endedError returns the error of a command that was ended by sig, the error of the
+// canceled runCtx or a TimeoutError
+func endedError(runCtx context.Context, timeout time.Duration, sig syscall.Signal) error {
+	if err := runCtx.Err(); err != nil {
+		return fmt.Errorf("command was ended by %s: %w", sig, err)
 	}
+	return &TimeoutError{Timeout: timeout, Signal: sig}
 }
@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"reflect"
+	"syscall"
 	"testing"
 	"text/template"
 	"time"
@@ -16,16 +19,21 @@ func createTestTemplate() *template.Template {
 	return tmpl
 }
 
+func createTestArgTemplates(args ...string) []*template.Template {
+	tmpls, _ := ParseArgTemplates(args)
+	return tmpls
+}
+
 var runnerTestTable = []struct {
-	data      map[string]string
+	data      map[string]interface{}
 	cmdString string
-	args      []string
+	args      []*template.Template
 	template  *template.Template
 }{
 	{
-		map[string]string{"key": "value"},
+		map[string]interface{}{"key": "value"},
 		"cat",
-		[]string{"-"},
+		createTestArgTemplates("-"),
 		createTestTemplate(),
 	},
 }
@@ -33,17 +41,18 @@ var runnerTestTable = []struct {
 func TestNewPipeRunner(t *testing.T) {
 	for _, tt := range runnerTestTable {
 		_ = NewPipeRunner(
-			context.Background(),
 			tt.cmdString,
 			tt.args,
 			5*time.Second,
+			time.Second,
+			Process{},
 			tt.template,
 		)
 	}
 }
 
 func createMockExecFunc() ExecFunc {
-	return func(r io.Reader, w io.Writer) error {
+	return func(ctx context.Context, inv Invocation, r io.Reader, w, ew io.Writer) error {
 		b := bufio.NewReader(r)
 		b.WriteTo(w)
 		return nil
@@ -51,13 +60,13 @@ func createMockExecFunc() ExecFunc {
 }
 
 var runTestTable = []struct {
-	data           map[string]string
+	data           map[string]interface{}
 	template       *template.Template
 	expectedOutput []byte
 	execFunc       ExecFunc
 }{
 	{
-		map[string]string{"key": "value"},
+		map[string]interface{}{"key": "value"},
 		createTestTemplate(),
 		[]byte(`value`),
 		createMockExecFunc(),
@@ -71,7 +80,7 @@ func TestPipeRunner_Run(t *testing.T) {
 			StdinTemplate: tt.template,
 		}
 		out := new(bytes.Buffer)
-		err := pr.Run(tt.data, out)
+		err := pr.Run(context.Background(), tt.data, nil, out, nil)
 		if err != nil {
 			t.Errorf("running mock exec func returned an error: %s", err)
 		}
@@ -86,14 +95,15 @@ func TestPipeRunner_Run(t *testing.T) {
 func TestPipeRunner_Run2(t *testing.T) {
 	for _, tt := range runnerTestTable {
 		pr := NewPipeRunner(
-			context.Background(),
 			tt.cmdString,
 			tt.args,
 			5*time.Second,
+			time.Second,
+			Process{},
 			tt.template,
 		)
 		b := new(bytes.Buffer)
-		err := pr.Run(tt.data, b)
+		err := pr.Run(context.Background(), tt.data, nil, b, nil)
 		if err != nil {
 			t.Errorf("running %s returned an error: %s",
 				tt.cmdString, err,
@@ -107,3 +117,120 @@ func TestPipeRunner_Run2(t *testing.T) {
 		}
 	}
 }
+
+var invocationTestTable = []struct {
+	data     map[string]interface{}
+	meta     Metadata
+	args     []string
+	env      map[string]string
+	workdir  string
+	expected Invocation
+}{
+	{
+		map[string]interface{}{"host": "web01; rm -rf /", "service": "nginx"},
+		Metadata{"sender": "nagios"},
+		[]string{"--host", "{{.host}}", "--from={{.envelope.sender}}"},
+		map[string]string{"SERVICE": "{{.service}}", "STATIC": "value"},
+		"/tmp/{{.service}}",
+		Invocation{
+			Args: []string{"--host", "web01; rm -rf /", "--from=nagios"},
+			Env:  []string{"SERVICE=nginx", "STATIC=value"},
+			Dir:  "/tmp/nginx",
+		},
+	},
+}
+
+func TestPipeRunner_invocation(t *testing.T) {
+	for _, tt := range invocationTestTable {
+		envTemplates, err := ParseEnvTemplates(tt.env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pr := &PipeRunner{
+			ArgTemplates:    createTestArgTemplates(tt.args...),
+			EnvTemplates:    envTemplates,
+			WorkdirTemplate: template.Must(template.New("workdir").Parse(tt.workdir)),
+		}
+		inv, err := pr.invocation(tt.data, tt.meta)
+		if err != nil {
+			t.Fatalf("rendering the invocation failed: %s", err)
+		}
+		if !reflect.DeepEqual(inv, tt.expected) {
+			t.Errorf("expected invocation %q, got %q", tt.expected, inv)
+		}
+	}
+}
+
+func TestPipeRunner_Run3(t *testing.T) {
+	workdir := "/"
+	envTemplates, _ := ParseEnvTemplates(map[string]string{"EVENTHANDLER_TEST": "{{.key}}"})
+	pr := NewPipeRunner(
+		"sh",
+		createTestArgTemplates("-c", `printf "%s %s %s" "$1" "$EVENTHANDLER_TEST" "$(pwd)"`, "sh", "{{.key}} $(id)"),
+		5*time.Second,
+		time.Second,
+		Process{},
+		createTestTemplate(),
+	)
+	pr.EnvTemplates = envTemplates
+	pr.WorkdirTemplate = template.Must(template.New("workdir").Parse(workdir))
+	b := new(bytes.Buffer)
+	err := pr.Run(context.Background(), map[string]interface{}{"key": "value"}, nil, b, nil)
+	if err != nil {
+		t.Fatalf("running sh returned an error: %s", err)
+	}
+	expected := "value $(id) value /"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+}
+
+func TestParseEnvTemplates(t *testing.T) {
+	for _, key := range []string{"", "A=B"} {
+		_, err := ParseEnvTemplates(map[string]string{key: "value"})
+		if err == nil {
+			t.Errorf("parsing environment variable %q should fail", key)
+		}
+	}
+}
+
+var timeoutTestTable = []struct {
+	script         string
+	expectedSignal syscall.Signal
+}{
+	// the background child would keep running without the process group kill
+	{`sleep 60 & wait`, syscall.SIGTERM},
+	{`trap "" TERM; sleep 60 & wait; wait`, syscall.SIGKILL},
+}
+
+func TestNewExecFunc(t *testing.T) {
+	for _, tt := range timeoutTestTable {
+		execFunc := newExecFunc("sh", 200*time.Millisecond, 200*time.Millisecond, Process{})
+		start := time.Now()
+		err := execFunc(context.Background(), Invocation{Args: []string{"-c", tt.script}}, new(bytes.Buffer), new(bytes.Buffer), nil)
+		timeoutErr, ok := err.(*TimeoutError)
+		if !ok {
+			t.Fatalf("expected a TimeoutError running %q, got %v", tt.script, err)
+		}
+		if timeoutErr.Signal != tt.expectedSignal {
+			t.Errorf("expected %q to be ended by %s, got %s", tt.script, tt.expectedSignal, timeoutErr.Signal)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("running %q took %s, the process group wasn't killed", tt.script, time.Since(start))
+		}
+	}
+}
+
+func TestNewExecFunc_cancel(t *testing.T) {
+	execFunc := newExecFunc("sh", time.Minute, time.Minute, Process{})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	err := execFunc(ctx, Invocation{Args: []string{"-c", "sleep 60 & wait"}}, new(bytes.Buffer), new(bytes.Buffer), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the command to be canceled, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("canceling the command took %s", time.Since(start))
+	}
+}
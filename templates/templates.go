@@ -0,0 +1,218 @@
+// Package templates provides the text/template function library that is shared by
+// the runner templates and the payload template filter
+package templates
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// New returns a new template with the function library. Accessing a missing map key
+// fails the template execution instead of rendering "<no value>"
+func New(name string) *template.Template {
+	return template.New(name).Funcs(FuncMap()).Option("missingkey=error")
+}
+
+// FuncMap returns the function library
+//
+//	toJson      json encodes a value
+//	default     returns the default (first argument) if the value is empty, i.e.
+//	            {{ index . "key" | default "none" }} for a possibly missing key
+//	required    fails the execution with a message if the value is empty
+//	shellQuote  quotes a string for safe use as a single POSIX shell word
+//	env         returns the value of an environment variable of the eventhandler process
+//	now         returns the current time
+//	formatTime  formats a time.Time, a RFC3339 string or unix seconds with a go time layout
+//	upper, lower, trim, join, split, replace
+//	            wrappers of the functions in package strings
+//	b64enc, b64dec
+//	            standard base64 encoding and decoding
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"toJson":     toJson,
+		"default":    defaultValue,
+		"required":   required,
+		"shellQuote": shellQuote,
+		"env":        os.Getenv,
+		"now":        time.Now,
+		"formatTime": formatTime,
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"trim":       strings.TrimSpace,
+		"join":       join,
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"b64enc":     func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":     b64dec,
+	}
+}
+
+// toJson returns the json encoding of v
+func toJson(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// empty indicates if v is nil or the zero value of its type
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+}
+
+// defaultValue returns def if v is empty, otherwise v
+func defaultValue(def interface{}, v ...interface{}) interface{} {
+	if len(v) == 0 || empty(v[0]) {
+		return def
+	}
+	return v[0]
+}
+
+// required returns v or an error with msg if v is empty
+func required(msg string, v interface{}) (interface{}, error) {
+	if empty(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// join joins the string representation of the elements of a list with sep
+func join(sep string, list interface{}) (string, error) {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: %T is not a list", list)
+	}
+	elems := []string{}
+	for i := 0; i < rv.Len(); i++ {
+		elems = append(elems, fmt.Sprint(rv.Index(i).Interface()))
+	}
+	return strings.Join(elems, sep), nil
+}
+
+// formatTime formats t with layout. t can be a time.Time, a RFC3339 string
+// or a number of seconds since the unix epoch (as decoded from json)
+func formatTime(layout string, t interface{}) (string, error) {
+	switch v := t.(type) {
+	case time.Time:
+		return v.Format(layout), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			secs, nerr := strconv.ParseInt(v, 10, 64)
+			if nerr != nil {
+				return "", fmt.Errorf("formatTime: %s", err)
+			}
+			parsed = time.Unix(secs, 0)
+		}
+		return parsed.Format(layout), nil
+	case float64:
+		return time.Unix(int64(v), 0).Format(layout), nil
+	case int:
+		return time.Unix(int64(v), 0).Format(layout), nil
+	case int64:
+		return time.Unix(v, 0).Format(layout), nil
+	}
+	return "", fmt.Errorf("formatTime: unsupported type %T", t)
+}
+
+// b64dec decodes standard base64 encoded s
+func b64dec(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ParseDir parses all regular, non hidden files in dir into one template set. Every file
+// is available under its base name and all templates it defines, so the templates of the
+// set can include each other, i.e. {{ template "header" . }}
+func ParseDir(dir string) (*template.Template, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template directory: %s", err)
+	}
+	set := New(filepath.Base(dir))
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		err = parseFileInto(set, filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// ParseFile parses the file at path into a copy of set and returns the template of the file.
+// If set is nil, the file is parsed into a new set
+func ParseFile(set *template.Template, path string) (*template.Template, error) {
+	set, err := cloneSet(set)
+	if err != nil {
+		return nil, err
+	}
+	err = parseFileInto(set, path)
+	if err != nil {
+		return nil, err
+	}
+	return set.Lookup(filepath.Base(path)), nil
+}
+
+// Parse parses text as template name into a copy of set. If set is nil, text is parsed
+// into a new set
+func Parse(set *template.Template, name, text string) (*template.Template, error) {
+	set, err := cloneSet(set)
+	if err != nil {
+		return nil, err
+	}
+	return set.New(name).Parse(text)
+}
+
+// cloneSet returns a copy of set or a new set if set is nil
+func cloneSet(set *template.Template) (*template.Template, error) {
+	if set == nil {
+		return New("templates"), nil
+	}
+	return set.Clone()
+}
+
+// parseFileInto parses the file at path as template named by the base name of path
+// into set. Parse errors contain the path and the line of the error
+func parseFileInto(set *template.Template, path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read template file: %s", err)
+	}
+	_, err = set.New(filepath.Base(path)).Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template file %s: %s", path, err)
+	}
+	return nil
+}
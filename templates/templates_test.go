@@ -0,0 +1,127 @@
+package templates
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+var templateTestTable = []struct {
+	template string
+	data     interface{}
+	expected string
+}{
+	{`{{ toJson . }}`, map[string]interface{}{"a": []int{1, 2}}, `{"a":[1,2]}`},
+	{`{{ index . "missing" | default "none" }}`, map[string]interface{}{}, `none`},
+	{`{{ .key | default "none" }}`, map[string]interface{}{"key": "value"}, `value`},
+	{`{{ .key | required "key is required" }}`, map[string]interface{}{"key": "value"}, `value`},
+	{`{{ shellQuote .key }}`, map[string]interface{}{"key": "it's $(id)"}, `'it'\''s $(id)'`},
+	{`{{ env "EVENTHANDLER_TEMPLATE_TEST" }}`, nil, `from env`},
+	{`{{ upper .key }} {{ lower .key }}`, map[string]interface{}{"key": "MiXeD"}, `MIXED mixed`},
+	{`{{ .t | formatTime "2006-01-02" }}`, map[string]interface{}{"t": 1496577600.0}, `2017-06-04`},
+	{`{{ .t | formatTime "15:04" }}`, map[string]interface{}{"t": "2017-06-04T13:37:00Z"}, `13:37`},
+	{`{{ .key | b64enc }} {{ "dmFsdWU=" | b64dec }}`, map[string]interface{}{"key": "value"}, `dmFsdWU= value`},
+	{`{{ .list | join "," }}`, map[string]interface{}{"list": []interface{}{"a", 1.5}}, `a,1.5`},
+	{`{{ now | formatTime "2006" | len }}`, nil, `4`},
+}
+
+func TestFuncMap(t *testing.T) {
+	os.Setenv("EVENTHANDLER_TEMPLATE_TEST", "from env")
+	for _, tt := range templateTestTable {
+		tmpl, err := New("test").Parse(tt.template)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %s", tt.template, err)
+		}
+		b := new(bytes.Buffer)
+		err = tmpl.Execute(b, tt.data)
+		if err != nil {
+			t.Errorf("executing %q failed: %s", tt.template, err)
+			continue
+		}
+		if b.String() != tt.expected {
+			t.Errorf("expected %q to render %q, got %q", tt.template, tt.expected, b.String())
+		}
+	}
+}
+
+var failingTemplateTestTable = []struct {
+	template string
+	data     interface{}
+}{
+	{`{{ .missing }}`, map[string]interface{}{}},
+	{`{{ .key | required "key is required" }}`, map[string]interface{}{"key": ""}},
+	{`{{ "not base64" | b64dec }}`, nil},
+	{`{{ .t | formatTime "15:04" }}`, map[string]interface{}{"t": true}},
+}
+
+func TestFuncMap2(t *testing.T) {
+	for _, tt := range failingTemplateTestTable {
+		tmpl, err := New("test").Parse(tt.template)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %s", tt.template, err)
+		}
+		err = tmpl.Execute(new(bytes.Buffer), tt.data)
+		if err == nil {
+			t.Errorf("executing %q should fail", tt.template)
+		}
+	}
+}
+
+var includeData = map[string]interface{}{
+	"check_name": "check_disk",
+	"host":       "web01",
+	"output":     "disk full",
+}
+
+func TestParseDir(t *testing.T) {
+	set, err := ParseDir("testdata/includes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := Parse(set, "inline", `{{ template "header" . }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	err = tmpl.Execute(b, includeData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "check check_disk on web01" {
+		t.Errorf("unexpected rendering of included template: %q", b.String())
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	set, err := ParseDir("testdata/includes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseFile(set, "testdata/includes/body.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	err = tmpl.Execute(b, includeData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "check check_disk on web01: DISK FULL\n" {
+		t.Errorf("unexpected rendering of template file: %q", b.String())
+	}
+}
+
+func TestParseFile2(t *testing.T) {
+	_, err := ParseFile(nil, "testdata/broken/broken.tmpl")
+	if err == nil {
+		t.Fatal("parsing a broken template file should fail")
+	}
+	if !strings.Contains(err.Error(), "testdata/broken/broken.tmpl") || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expected the error to contain the file and the line, got %s", err)
+	}
+	_, err = ParseDir("testdata/broken")
+	if err == nil {
+		t.Fatal("parsing a directory with a broken template file should fail")
+	}
+}
@@ -3,8 +3,9 @@ package verify
 import (
 	"bytes"
 	"errors"
-	"golang.org/x/crypto/openpgp"
 	"io"
+
+	"golang.org/x/crypto/openpgp"
 )
 
 type Signer struct {